@@ -1,17 +1,49 @@
 package client
 
+import "time"
+
 type Message interface{}
 
+// Properties are the basic properties a publisher sends along with the body.
+// Properties that were not sent are left empty.
+type Properties struct {
+	ContentType     string         `json:"content_type,omitempty"`
+	ContentEncoding string         `json:"content_encoding,omitempty"`
+	Headers         map[string]any `json:"headers,omitempty"`
+	DeliveryMode    uint8          `json:"delivery_mode,omitempty"`
+	Priority        uint8          `json:"priority,omitempty"`
+	CorrelationID   string         `json:"correlation_id,omitempty"`
+	ReplyTo         string         `json:"reply_to,omitempty"`
+	Expiration      string         `json:"expiration,omitempty"`
+	MessageID       string         `json:"message_id,omitempty"`
+	Timestamp       *time.Time     `json:"timestamp,omitempty"`
+	Type            string         `json:"type,omitempty"`
+	UserID          string         `json:"user_id,omitempty"`
+	AppID           string         `json:"app_id,omitempty"`
+}
+
 // Client messages
 type (
 	// Hello is sent by a client to initiate
 	Hello struct{}
 
+	// UnsupportedProtocol is sent instead of Hello by clients speaking another protocol
+	UnsupportedProtocol struct {
+		Header []byte
+	}
+
 	// ConnectionStartOk starts connection negotiation
 	ConnectionStartOk struct {
-		Mechanism string
-		User      string
-		Pass      string
+		// Properties the client sent about itself, including its capabilities
+		Properties map[string]any
+		Mechanism  string
+		// Response holds the credentials encoded as required by Mechanism
+		Response string
+	}
+
+	// ConnectionSecureOk answers a challenge sent with connection.secure
+	ConnectionSecureOk struct {
+		Response string
 	}
 )
 
@@ -29,6 +61,17 @@ type (
 		VirtualHost string
 	}
 
+	// ConnectionClose is sent by a client that wants to shut down the connection
+	ConnectionClose struct {
+		ReplyCode uint16
+		ReplyText string
+		ClassID   uint16
+		MethodID  uint16
+	}
+
+	// ConnectionCloseOk confirms a connection.close sent by the server
+	ConnectionCloseOk struct{}
+
 	ChannelOpen struct {
 		Channel uint16
 	}
@@ -37,25 +80,133 @@ type (
 		Channel uint16
 	}
 
+	// ChannelCloseOk confirms a channel.close sent by the server
+	ChannelCloseOk struct {
+		Channel uint16
+	}
+
+	// ChannelFlow asks the server to stop or resume deliveries on a channel
+	ChannelFlow struct {
+		Channel uint16
+		Active  bool
+	}
+
+	// ChannelFlowOk confirms a channel.flow sent by the server
+	ChannelFlowOk struct {
+		Channel uint16
+		Active  bool
+	}
+
 	BasicPublish struct {
+		Channel    uint16
 		Exchange   string
 		RoutingKey string
 	}
 
+	// BasicConsume subscribes to a queue; the server picks a tag if ConsumerTag is empty
+	BasicConsume struct {
+		Channel     uint16
+		Queue       string
+		ConsumerTag string
+		NoLocal     bool
+		NoAck       bool
+		Exclusive   bool
+		NoWait      bool
+		Arguments   map[string]any
+	}
+
+	// BasicCancel ends a subscription started with basic.consume
+	BasicCancel struct {
+		Channel     uint16
+		ConsumerTag string
+		NoWait      bool
+	}
+
 	Body struct {
+		Channel uint16
 		Payload string
 	}
 
 	ExchangeDeclare struct {
+		Channel    uint16
+		Exchange   string
+		Typ        string
+		Passive    bool
+		Durable    bool
+		AutoDelete bool
+		Internal   bool
+		NoWait     bool
+		Arguments  map[string]any
+	}
+
+	// ExchangeDelete removes an exchange and all bindings it is the source of
+	ExchangeDelete struct {
 		Channel  uint16
 		Exchange string
-		Typ      string
+		IfUnused bool
+		NoWait   bool
+	}
+
+	// QueueDeclare creates a queue, or checks that it exists if Passive.
+	// The server picks a name if Queue is empty.
+	QueueDeclare struct {
+		Channel    uint16
+		Queue      string
+		Passive    bool
+		Durable    bool
+		Exclusive  bool
+		AutoDelete bool
+		NoWait     bool
+		Arguments  map[string]any
 	}
 
-	Header struct{}
+	// QueueBind routes messages matching RoutingKey from Exchange to Queue
+	QueueBind struct {
+		Channel    uint16
+		Queue      string
+		Exchange   string
+		RoutingKey string
+		NoWait     bool
+		Arguments  map[string]any
+	}
+
+	// QueueUnbind removes a binding created with queue.bind
+	QueueUnbind struct {
+		Channel    uint16
+		Queue      string
+		Exchange   string
+		RoutingKey string
+		Arguments  map[string]any
+	}
+
+	// QueuePurge drops all messages of a queue
+	QueuePurge struct {
+		Channel uint16
+		Queue   string
+		NoWait  bool
+	}
+
+	// QueueDelete removes a queue and its bindings
+	QueueDelete struct {
+		Channel  uint16
+		Queue    string
+		IfUnused bool
+		IfEmpty  bool
+		NoWait   bool
+	}
+
+	// Header announces the size and properties of the body that follows a publish
+	Header struct {
+		Channel    uint16
+		BodySize   uint64
+		Properties Properties
+	}
 
+	// Invalid is reported for frames that could not be handled.
+	// A non-zero Code is a connection error that requires closing the connection.
 	Invalid struct {
-		Err string
+		Code uint16
+		Err  string
 	}
 
 	Heartbeat struct{}
@@ -0,0 +1,277 @@
+package amqp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// argument types of methods
+const (
+	argOctet     = "octet"
+	argShort     = "short"
+	argLong      = "long"
+	argLongLong  = "longlong"
+	argBit       = "bit"
+	argShortStr  = "shortstr"
+	argLongStr   = "longstr"
+	argTimestamp = "timestamp"
+	argTable     = "table"
+)
+
+type methodSpec struct {
+	name string
+	// args in the form "name type"
+	args []string
+}
+
+// methodKey identifies a method by its class and method id
+func methodKey(class, method uint16) uint32 {
+	return uint32(class)<<16 | uint32(method)
+}
+
+// methods of AMQP 0-9-1 including the RabbitMQ extensions
+var methods = map[uint32]methodSpec{
+	methodKey(10, 10): {"connection.start", []string{"version-major octet", "version-minor octet", "server-properties table", "mechanisms longstr", "locales longstr"}},
+	methodKey(10, 11): {"connection.start-ok", []string{"client-properties table", "mechanism shortstr", "response longstr", "locale shortstr"}},
+	methodKey(10, 20): {"connection.secure", []string{"challenge longstr"}},
+	methodKey(10, 21): {"connection.secure-ok", []string{"response longstr"}},
+	methodKey(10, 30): {"connection.tune", []string{"channel-max short", "frame-max long", "heartbeat short"}},
+	methodKey(10, 31): {"connection.tune-ok", []string{"channel-max short", "frame-max long", "heartbeat short"}},
+	methodKey(10, 40): {"connection.open", []string{"virtual-host shortstr", "reserved-1 shortstr", "reserved-2 bit"}},
+	methodKey(10, 41): {"connection.open-ok", []string{"reserved-1 shortstr"}},
+	methodKey(10, 50): {"connection.close", []string{"reply-code short", "reply-text shortstr", "class-id short", "method-id short"}},
+	methodKey(10, 51): {"connection.close-ok", nil},
+	methodKey(10, 60): {"connection.blocked", []string{"reason shortstr"}},
+	methodKey(10, 61): {"connection.unblocked", nil},
+
+	methodKey(20, 10): {"channel.open", []string{"reserved-1 shortstr"}},
+	methodKey(20, 11): {"channel.open-ok", []string{"reserved-1 longstr"}},
+	methodKey(20, 20): {"channel.flow", []string{"active bit"}},
+	methodKey(20, 21): {"channel.flow-ok", []string{"active bit"}},
+	methodKey(20, 40): {"channel.close", []string{"reply-code short", "reply-text shortstr", "class-id short", "method-id short"}},
+	methodKey(20, 41): {"channel.close-ok", nil},
+
+	methodKey(40, 10): {"exchange.declare", []string{"reserved-1 short", "exchange shortstr", "type shortstr", "passive bit", "durable bit", "auto-delete bit", "internal bit", "no-wait bit", "arguments table"}},
+	methodKey(40, 11): {"exchange.declare-ok", nil},
+	methodKey(40, 20): {"exchange.delete", []string{"reserved-1 short", "exchange shortstr", "if-unused bit", "no-wait bit"}},
+	methodKey(40, 21): {"exchange.delete-ok", nil},
+	methodKey(40, 30): {"exchange.bind", []string{"reserved-1 short", "destination shortstr", "source shortstr", "routing-key shortstr", "no-wait bit", "arguments table"}},
+	methodKey(40, 31): {"exchange.bind-ok", nil},
+	methodKey(40, 40): {"exchange.unbind", []string{"reserved-1 short", "destination shortstr", "source shortstr", "routing-key shortstr", "no-wait bit", "arguments table"}},
+	methodKey(40, 51): {"exchange.unbind-ok", nil},
+
+	methodKey(50, 10): {"queue.declare", []string{"reserved-1 short", "queue shortstr", "passive bit", "durable bit", "exclusive bit", "auto-delete bit", "no-wait bit", "arguments table"}},
+	methodKey(50, 11): {"queue.declare-ok", []string{"queue shortstr", "message-count long", "consumer-count long"}},
+	methodKey(50, 20): {"queue.bind", []string{"reserved-1 short", "queue shortstr", "exchange shortstr", "routing-key shortstr", "no-wait bit", "arguments table"}},
+	methodKey(50, 21): {"queue.bind-ok", nil},
+	methodKey(50, 30): {"queue.purge", []string{"reserved-1 short", "queue shortstr", "no-wait bit"}},
+	methodKey(50, 31): {"queue.purge-ok", []string{"message-count long"}},
+	methodKey(50, 40): {"queue.delete", []string{"reserved-1 short", "queue shortstr", "if-unused bit", "if-empty bit", "no-wait bit"}},
+	methodKey(50, 41): {"queue.delete-ok", []string{"message-count long"}},
+	methodKey(50, 50): {"queue.unbind", []string{"reserved-1 short", "queue shortstr", "exchange shortstr", "routing-key shortstr", "arguments table"}},
+	methodKey(50, 51): {"queue.unbind-ok", nil},
+
+	methodKey(60, 10):  {"basic.qos", []string{"prefetch-size long", "prefetch-count short", "global bit"}},
+	methodKey(60, 11):  {"basic.qos-ok", nil},
+	methodKey(60, 20):  {"basic.consume", []string{"reserved-1 short", "queue shortstr", "consumer-tag shortstr", "no-local bit", "no-ack bit", "exclusive bit", "no-wait bit", "arguments table"}},
+	methodKey(60, 21):  {"basic.consume-ok", []string{"consumer-tag shortstr"}},
+	methodKey(60, 30):  {"basic.cancel", []string{"consumer-tag shortstr", "no-wait bit"}},
+	methodKey(60, 31):  {"basic.cancel-ok", []string{"consumer-tag shortstr"}},
+	methodKey(60, 40):  {"basic.publish", []string{"reserved-1 short", "exchange shortstr", "routing-key shortstr", "mandatory bit", "immediate bit"}},
+	methodKey(60, 50):  {"basic.return", []string{"reply-code short", "reply-text shortstr", "exchange shortstr", "routing-key shortstr"}},
+	methodKey(60, 60):  {"basic.deliver", []string{"consumer-tag shortstr", "delivery-tag longlong", "redelivered bit", "exchange shortstr", "routing-key shortstr"}},
+	methodKey(60, 70):  {"basic.get", []string{"reserved-1 short", "queue shortstr", "no-ack bit"}},
+	methodKey(60, 71):  {"basic.get-ok", []string{"delivery-tag longlong", "redelivered bit", "exchange shortstr", "routing-key shortstr", "message-count long"}},
+	methodKey(60, 72):  {"basic.get-empty", []string{"reserved-1 shortstr"}},
+	methodKey(60, 80):  {"basic.ack", []string{"delivery-tag longlong", "multiple bit"}},
+	methodKey(60, 90):  {"basic.reject", []string{"delivery-tag longlong", "requeue bit"}},
+	methodKey(60, 100): {"basic.recover-async", []string{"requeue bit"}},
+	methodKey(60, 110): {"basic.recover", []string{"requeue bit"}},
+	methodKey(60, 111): {"basic.recover-ok", nil},
+	methodKey(60, 120): {"basic.nack", []string{"delivery-tag longlong", "multiple bit", "requeue bit"}},
+
+	methodKey(85, 10): {"confirm.select", []string{"no-wait bit"}},
+	methodKey(85, 11): {"confirm.select-ok", nil},
+
+	methodKey(90, 10): {"tx.select", nil},
+	methodKey(90, 11): {"tx.select-ok", nil},
+	methodKey(90, 20): {"tx.commit", nil},
+	methodKey(90, 21): {"tx.commit-ok", nil},
+	methodKey(90, 30): {"tx.rollback", nil},
+	methodKey(90, 31): {"tx.rollback-ok", nil},
+}
+
+// MethodName returns the name of a method like basic.publish, or its ids if it is unknown
+func MethodName(class, method uint16) string {
+	if spec, ok := methods[methodKey(class, method)]; ok {
+		return spec.name
+	}
+
+	return fmt.Sprintf("unknown method %v.%v", class, method)
+}
+
+// Describe decodes a frame for humans: its type, channel, size and, for methods, name and arguments.
+// The frame may include its frame-end octet. Protocol headers are described as well.
+func Describe(frame []byte) string {
+	if len(frame) == len(Hello) && bytes.HasPrefix(frame, []byte("AMQP")) {
+		return "protocol header " + DescribeProtocolHeader(frame)
+	}
+	if len(frame) < FrameHeaderSize {
+		return fmt.Sprintf("incomplete frame of %v bytes", len(frame))
+	}
+
+	typ := frame[0]
+	channel := binary.BigEndian.Uint16(frame[1:3])
+	size := binary.BigEndian.Uint32(frame[3:7])
+	payload := frame[FrameHeaderSize:]
+	if uint64(len(payload)) > uint64(size) {
+		payload = payload[:size]
+	}
+
+	var kind, details string
+	switch typ {
+	case TypeMethod:
+		kind, details = "method", describeMethod(payload)
+	case TypeHeader:
+		kind, details = "content header", describeHeader(payload)
+	case TypeBody:
+		kind = "content body"
+	case TypeHeartbeat:
+		kind = "heartbeat"
+	default:
+		kind = fmt.Sprintf("unknown frame type %v", typ)
+	}
+
+	description := fmt.Sprintf("%v frame on channel %v with %v bytes", kind, channel, size)
+	if uint64(len(payload)) < uint64(size) {
+		description += fmt.Sprintf(" of which only %v arrived", len(payload))
+	}
+	if details != "" {
+		description += ": " + details
+	}
+
+	return description
+}
+
+func describeMethod(payload []byte) string {
+	if len(payload) < 4 {
+		return "missing class and method id"
+	}
+
+	class := binary.BigEndian.Uint16(payload[0:2])
+	method := binary.BigEndian.Uint16(payload[2:4])
+	spec, ok := methods[methodKey(class, method)]
+	if !ok {
+		return MethodName(class, method)
+	}
+
+	args, err := describeArgs(bytes.NewBuffer(payload[4:]), spec.args)
+	description := spec.name + "(" + strings.Join(args, ", ") + ")"
+	if err != nil {
+		description += fmt.Sprintf(" could not decode further arguments: %v", err)
+	}
+
+	return description
+}
+
+// describeArgs decodes arguments in the form name=value; consecutive bits share octets
+func describeArgs(buf *bytes.Buffer, specs []string) ([]string, error) {
+	var (
+		args []string
+		bits byte
+		bit  = 8
+	)
+	for _, spec := range specs {
+		name, typ, _ := strings.Cut(spec, " ")
+		if typ != argBit {
+			bit = 8
+		}
+
+		var (
+			value any
+			err   error
+		)
+		switch typ {
+		case argOctet:
+			value, err = buf.ReadByte()
+		case argShort:
+			var v uint16
+			err = binary.Read(buf, binary.BigEndian, &v)
+			value = v
+		case argLong:
+			var v uint32
+			err = binary.Read(buf, binary.BigEndian, &v)
+			value = v
+		case argLongLong:
+			var v uint64
+			err = binary.Read(buf, binary.BigEndian, &v)
+			value = v
+		case argTimestamp:
+			var v uint64
+			err = binary.Read(buf, binary.BigEndian, &v)
+			value = time.Unix(int64(v), 0).UTC()
+		case argBit:
+			if bit == 8 {
+				if bits, err = buf.ReadByte(); err != nil {
+					break
+				}
+				bit = 0
+			}
+			value = bits&(1<<bit) != 0
+			bit++
+		case argShortStr:
+			var v string
+			v, err = readShortString(buf)
+			value = fmt.Sprintf("%q", v)
+		case argLongStr:
+			var v string
+			v, err = readLongString(buf)
+			value = fmt.Sprintf("%q", v)
+		case argTable:
+			var v map[string]any
+			if v, err = readTable(buf); err == nil {
+				value = describeTable(v)
+			}
+		}
+		if err != nil {
+			return args, fmt.Errorf("%v: %w", name, err)
+		}
+
+		args = append(args, fmt.Sprintf("%v=%v", name, value))
+	}
+
+	return args, nil
+}
+
+func describeHeader(payload []byte) string {
+	buf := bytes.NewBuffer(payload)
+
+	var header struct {
+		Class, Weight uint16
+		BodySize      uint64
+	}
+	if err := binary.Read(buf, binary.BigEndian, &header); err != nil {
+		return fmt.Sprintf("could not decode header: %v", err)
+	}
+
+	properties, err := readProperties(buf)
+	if err != nil {
+		return fmt.Sprintf("class %v, body size %v, could not decode properties: %v", header.Class, header.BodySize, err)
+	}
+
+	return fmt.Sprintf("class %v, body size %v, properties %v", header.Class, header.BodySize, describeTable(properties))
+}
+
+// describeTable prints tables and properties as JSON which is easier to read than Go's map syntax
+func describeTable(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+
+	return string(data)
+}
@@ -0,0 +1,116 @@
+package amqp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// FrameHeaderSize is the size of type, channel and payload size that precede every payload
+const FrameHeaderSize = 7
+
+// ErrFrameEnd is returned when a frame is not terminated by EndMark
+var ErrFrameEnd = errors.New("frame does not end with frame-end octet")
+
+// FrameTooLargeError is returned for frames exceeding the negotiated frame-max
+type FrameTooLargeError struct {
+	Channel uint16
+	Size    uint32
+	Max     uint32
+}
+
+func (e *FrameTooLargeError) Error() string {
+	return fmt.Sprintf("frame of %v bytes on channel %v exceeds frame-max of %v", e.Size, e.Channel, e.Max)
+}
+
+// ReadProtocolHeader reads the 8 bytes a client sends before any frame.
+// Clients speaking 0-9-1 send Hello.
+func ReadProtocolHeader(r io.Reader) ([]byte, error) {
+	header := make([]byte, len(Hello))
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	return header, nil
+}
+
+// DescribeProtocolHeader names the protocol a client tried to speak
+func DescribeProtocolHeader(header []byte) string {
+	if bytes.HasPrefix(header, []byte("AMQP")) && len(header) == len(Hello) {
+		id, version := header[4], header[5:]
+		switch {
+		case bytes.Equal(header, Hello):
+			return "AMQP 0-9-1"
+		case id == 0 && bytes.Equal(version, []byte{1, 0, 0}):
+			return "AMQP 1.0"
+		case id == 2 && bytes.Equal(version, []byte{1, 0, 0}):
+			return "AMQP 1.0 over TLS"
+		case id == 3 && bytes.Equal(version, []byte{1, 0, 0}):
+			return "AMQP 1.0 with SASL"
+		case id == 1 && bytes.Equal(version, []byte{1, 8, 0}): // 0-8 puts its major version first
+			return "AMQP 0-8"
+		case id == 1 && version[0] == 1:
+			return fmt.Sprintf("AMQP %v-%v", version[1], version[2])
+		}
+
+		return fmt.Sprintf("AMQP with protocol id %v and version %v.%v.%v", id, version[0], version[1], version[2])
+	}
+
+	for _, method := range []string{"GET ", "POST ", "PUT ", "HEAD ", "DELETE ", "OPTIONS ", "PATCH ", "CONNECT "} {
+		if bytes.HasPrefix(header, []byte(method)) {
+			return "HTTP"
+		}
+	}
+	if len(header) > 1 && header[0] == 0x16 && header[1] == 0x03 {
+		return "TLS"
+	}
+
+	return fmt.Sprintf("an unknown protocol starting with %q", header)
+}
+
+// ReadFrame reads a single frame from r.
+// The returned frame includes its header but not the frame-end octet, which is what Parse expects.
+// Frames larger than max (counting header and frame-end) are skipped; a max of 0 means no limit.
+func ReadFrame(r io.Reader, max uint32) ([]byte, error) {
+	header := make([]byte, FrameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[3:7])
+	total := uint64(size) + FrameHeaderSize + 1
+	if max > 0 && total > uint64(max) {
+		if _, err := io.CopyN(io.Discard, r, int64(size)+1); err != nil {
+			return nil, err
+		}
+
+		return nil, &FrameTooLargeError{
+			Channel: binary.BigEndian.Uint16(header[1:3]),
+			Size:    uint32(total),
+			Max:     max,
+		}
+	}
+
+	frame := make([]byte, total)
+	copy(frame, header)
+	if _, err := io.ReadFull(r, frame[FrameHeaderSize:]); err != nil {
+		return nil, err
+	}
+
+	if frame[len(frame)-1] != EndMark {
+		return nil, ErrFrameEnd
+	}
+
+	return frame[:len(frame)-1], nil
+}
+
+// FrameChannel returns the channel a frame read by ReadFrame was sent on
+func FrameChannel(frame []byte) uint16 {
+	if len(frame) < FrameHeaderSize {
+		return GlobalChannel
+	}
+
+	return binary.BigEndian.Uint16(frame[1:3])
+}
@@ -25,8 +25,8 @@ func Parse(msg []byte) client.Message {
 		return client.Invalid{Err: "could not read type of frame"}
 	}
 
-	if typ == TypeHeartbeat || typ == TypeHeader {
-		return client.Nothing{}
+	if typ == TypeHeartbeat {
+		return client.Heartbeat{}
 	}
 
 	var (
@@ -41,6 +41,34 @@ func Parse(msg []byte) client.Message {
 		return client.Invalid{Err: err.Error()}
 	}
 
+	if typ == TypeHeader {
+		var (
+			class    uint16
+			weight   uint16
+			bodySize uint64
+		)
+		if err := binary.Read(buffer, binary.BigEndian, &class); err != nil {
+			return client.Invalid{Err: "could not read header class"}
+		}
+		if err := binary.Read(buffer, binary.BigEndian, &weight); err != nil {
+			return client.Invalid{Err: "could not read header weight"}
+		}
+		if err := binary.Read(buffer, binary.BigEndian, &bodySize); err != nil {
+			return client.Invalid{Err: "could not read body size"}
+		}
+
+		properties, err := readProperties(buffer)
+		if err != nil {
+			return client.Invalid{Err: fmt.Sprintf("could not read properties: %v", err)}
+		}
+
+		return client.Header{
+			Channel:    channel,
+			BodySize:   bodySize,
+			Properties: properties,
+		}
+	}
+
 	if typ == TypeBody {
 		payload, err := io.ReadAll(buffer)
 		if err != nil {
@@ -48,6 +76,7 @@ func Parse(msg []byte) client.Message {
 		}
 
 		return client.Body{
+			Channel: channel,
 			Payload: string(payload),
 		}
 	}
@@ -71,36 +100,35 @@ func Parse(msg []byte) client.Message {
 
 	// todo: bissel verschachteln?
 	if class == ClassConnection && method == MethodConnectionStartOk {
-		relevant := msg[140:] // todo: dirty
-		buf := bytes.NewBuffer(relevant)
-
-		var msize uint8
-		if err := binary.Read(buf, binary.BigEndian, &msize); err != nil {
-			return client.Invalid{Err: "could not read msize"}
+		properties, err := readTable(buffer)
+		if err != nil {
+			return client.Invalid{Err: "could not read client properties"}
 		}
 
-		mechanism := make([]byte, msize)
-		if err := binary.Read(buf, binary.BigEndian, &mechanism); err != nil {
+		mechanism, err := readShortString(buffer)
+		if err != nil {
 			return client.Invalid{Err: "could not read mechanism"}
 		}
 
-		var csize uint32
-		if err := binary.Read(buf, binary.BigEndian, &csize); err != nil {
-			return client.Invalid{Err: "could not read user+pass size"}
-		}
-		credentials := make([]byte, csize) // PLAIN
-		if err := binary.Read(buf, binary.BigEndian, &credentials); err != nil {
-			return client.Invalid{Err: "could not read user and pass"}
+		response, err := readLongString(buffer)
+		if err != nil {
+			return client.Invalid{Err: "could not read response"}
 		}
-		creds := bytes.Split(credentials, []byte{0})
-		user, pass := creds[1], creds[2]
 
 		return client.ConnectionStartOk{
-			Mechanism: string(mechanism),
-			User:      string(user),
-			Pass:      string(pass),
+			Properties: properties,
+			Mechanism:  mechanism,
+			Response:   response,
 		}
 	}
+	if class == ClassConnection && method == MethodConnectionSecureOk {
+		response, err := readLongString(buffer)
+		if err != nil {
+			return client.Invalid{Err: "could not read response"}
+		}
+
+		return client.ConnectionSecureOk{Response: response}
+	}
 	if class == ClassConnection && method == MethodConnectionTuneOk {
 		var (
 			channelMax     uint16
@@ -138,12 +166,62 @@ func Parse(msg []byte) client.Message {
 		return client.ConnectionOpen{VirtualHost: string(vhost)}
 	}
 
+	if class == ClassConnection && method == MethodConnectionClose {
+		var replyCode uint16
+		if err := binary.Read(buffer, binary.BigEndian, &replyCode); err != nil {
+			return client.Invalid{Err: "could not read reply code"}
+		}
+
+		var tsize uint8
+		if err := binary.Read(buffer, binary.BigEndian, &tsize); err != nil {
+			return client.Invalid{Err: "could not read reply text size"}
+		}
+
+		replyText := make([]byte, tsize)
+		if err := binary.Read(buffer, binary.BigEndian, &replyText); err != nil {
+			return client.Invalid{Err: "could not read reply text"}
+		}
+
+		var classID, methodID uint16
+		if err := binary.Read(buffer, binary.BigEndian, &classID); err != nil {
+			return client.Invalid{Err: "could not read failing class"}
+		}
+		if err := binary.Read(buffer, binary.BigEndian, &methodID); err != nil {
+			return client.Invalid{Err: "could not read failing method"}
+		}
+
+		return client.ConnectionClose{
+			ReplyCode: replyCode,
+			ReplyText: string(replyText),
+			ClassID:   classID,
+			MethodID:  methodID,
+		}
+	}
+
+	if class == ClassConnection && method == MethodConnectionCloseOk {
+		return client.ConnectionCloseOk{}
+	}
+
 	if class == ClassChannel && method == MethodChannelOpen {
 		return client.ChannelOpen{Channel: channel}
 	}
+	if class == ClassChannel && (method == MethodChannelFlow || method == MethodChannelFlowOk) {
+		var active uint8
+		if err := binary.Read(buffer, binary.BigEndian, &active); err != nil {
+			return client.Invalid{Err: "could not read flow active"}
+		}
+
+		if method == MethodChannelFlowOk {
+			return client.ChannelFlowOk{Channel: channel, Active: active != 0}
+		}
+		return client.ChannelFlow{Channel: channel, Active: active != 0}
+	}
 	if class == ClassChannel && method == MethodChannelClose {
 		return client.ChannelClose{Channel: channel}
 	}
+	if class == ClassChannel && method == MethodChannelCloseOk {
+		return client.ChannelCloseOk{Channel: channel}
+	}
 
 	if class == ClassExchange && method == MethodExchangeDeclare {
 		var esize [3]byte // todo: this repeats below (thinking)
@@ -167,12 +245,41 @@ func Parse(msg []byte) client.Message {
 			return client.Invalid{Err: "could not read type"}
 		}
 
+		flags, err := readBits(buffer)
+		if err != nil {
+			return client.Invalid{Err: "could not read exchange flags"}
+		}
+		arguments, err := readTable(buffer)
+		if err != nil {
+			return client.Invalid{Err: fmt.Sprintf("could not read exchange arguments: %v", err)}
+		}
+
 		return client.ExchangeDeclare{
-			Channel:  channel,
-			Exchange: string(exchange),
-			Typ:      string(typ),
+			Channel:    channel,
+			Exchange:   string(exchange),
+			Typ:        string(typ),
+			Passive:    flags[0],
+			Durable:    flags[1],
+			AutoDelete: flags[2],
+			Internal:   flags[3],
+			NoWait:     flags[4],
+			Arguments:  arguments,
 		}
 	}
+	if class == ClassExchange && method == MethodExchangeDelete {
+		return parseExchangeDelete(channel, buffer)
+	}
+
+	if class == ClassQueue {
+		return parseQueue(channel, method, buffer)
+	}
+
+	if class == ClassBasic && method == MethodBasicConsume {
+		return parseBasicConsume(channel, buffer)
+	}
+	if class == ClassBasic && method == MethodBasicCancel {
+		return parseBasicCancel(channel, buffer)
+	}
 
 	if class == ClassBasic && method == MethodBasicPublish {
 		var esize [3]byte // idk why its 3 bytes
@@ -197,6 +304,7 @@ func Parse(msg []byte) client.Message {
 		}
 
 		return client.BasicPublish{
+			Channel:    channel,
 			Exchange:   string(exchange),
 			RoutingKey: string(routingKey),
 		}
@@ -204,3 +312,157 @@ func Parse(msg []byte) client.Message {
 
 	return client.Invalid{Err: "frame could not be parsed"}
 }
+
+func parseExchangeDelete(channel uint16, buffer *bytes.Buffer) client.Message {
+	var reserved uint16
+	if err := binary.Read(buffer, binary.BigEndian, &reserved); err != nil {
+		return client.Invalid{Err: "could not read reserved field"}
+	}
+	exchange, err := readShortString(buffer)
+	if err != nil {
+		return client.Invalid{Err: "could not read exchange"}
+	}
+	flags, err := readBits(buffer)
+	if err != nil {
+		return client.Invalid{Err: "could not read flags"}
+	}
+
+	return client.ExchangeDelete{Channel: channel, Exchange: exchange, IfUnused: flags[0], NoWait: flags[1]}
+}
+
+func parseBasicConsume(channel uint16, buffer *bytes.Buffer) client.Message {
+	var reserved uint16
+	if err := binary.Read(buffer, binary.BigEndian, &reserved); err != nil {
+		return client.Invalid{Err: "could not read reserved field"}
+	}
+	queue, err := readShortString(buffer)
+	if err != nil {
+		return client.Invalid{Err: "could not read queue"}
+	}
+	tag, err := readShortString(buffer)
+	if err != nil {
+		return client.Invalid{Err: "could not read consumer tag"}
+	}
+	flags, err := readBits(buffer)
+	if err != nil {
+		return client.Invalid{Err: "could not read flags"}
+	}
+	arguments, err := readTable(buffer)
+	if err != nil {
+		return client.Invalid{Err: fmt.Sprintf("could not read arguments: %v", err)}
+	}
+
+	return client.BasicConsume{
+		Channel:     channel,
+		Queue:       queue,
+		ConsumerTag: tag,
+		NoLocal:     flags[0],
+		NoAck:       flags[1],
+		Exclusive:   flags[2],
+		NoWait:      flags[3],
+		Arguments:   arguments,
+	}
+}
+
+func parseBasicCancel(channel uint16, buffer *bytes.Buffer) client.Message {
+	tag, err := readShortString(buffer)
+	if err != nil {
+		return client.Invalid{Err: "could not read consumer tag"}
+	}
+	flags, err := readBits(buffer)
+	if err != nil {
+		return client.Invalid{Err: "could not read flags"}
+	}
+
+	return client.BasicCancel{Channel: channel, ConsumerTag: tag, NoWait: flags[0]}
+}
+
+// parseQueue parses the methods of the queue class, which all start with the queue name
+func parseQueue(channel, method uint16, buffer *bytes.Buffer) client.Message {
+	var reserved uint16
+	if err := binary.Read(buffer, binary.BigEndian, &reserved); err != nil {
+		return client.Invalid{Err: "could not read reserved field"}
+	}
+	queue, err := readShortString(buffer)
+	if err != nil {
+		return client.Invalid{Err: "could not read queue"}
+	}
+
+	// bind and unbind continue with exchange and routing key
+	var exchange, routingKey string
+	if method == MethodQueueBind || method == MethodQueueUnbind {
+		if exchange, err = readShortString(buffer); err != nil {
+			return client.Invalid{Err: "could not read exchange"}
+		}
+		if routingKey, err = readShortString(buffer); err != nil {
+			return client.Invalid{Err: "could not read routing key"}
+		}
+	}
+
+	// unbind is the only one without flags
+	var flags [8]bool
+	if method != MethodQueueUnbind {
+		if flags, err = readBits(buffer); err != nil {
+			return client.Invalid{Err: "could not read flags"}
+		}
+	}
+
+	var arguments map[string]any
+	if method == MethodQueueDeclare || method == MethodQueueBind || method == MethodQueueUnbind {
+		if arguments, err = readTable(buffer); err != nil {
+			return client.Invalid{Err: fmt.Sprintf("could not read arguments: %v", err)}
+		}
+	}
+
+	switch method {
+	case MethodQueueDeclare:
+		return client.QueueDeclare{
+			Channel:    channel,
+			Queue:      queue,
+			Passive:    flags[0],
+			Durable:    flags[1],
+			Exclusive:  flags[2],
+			AutoDelete: flags[3],
+			NoWait:     flags[4],
+			Arguments:  arguments,
+		}
+	case MethodQueueBind:
+		return client.QueueBind{
+			Channel:    channel,
+			Queue:      queue,
+			Exchange:   exchange,
+			RoutingKey: routingKey,
+			NoWait:     flags[0],
+			Arguments:  arguments,
+		}
+	case MethodQueueUnbind:
+		return client.QueueUnbind{
+			Channel:    channel,
+			Queue:      queue,
+			Exchange:   exchange,
+			RoutingKey: routingKey,
+			Arguments:  arguments,
+		}
+	case MethodQueuePurge:
+		return client.QueuePurge{Channel: channel, Queue: queue, NoWait: flags[0]}
+	case MethodQueueDelete:
+		return client.QueueDelete{Channel: channel, Queue: queue, IfUnused: flags[0], IfEmpty: flags[1], NoWait: flags[2]}
+	}
+
+	return client.Invalid{Err: "frame could not be parsed"}
+}
+
+// readBits reads an octet packing up to 8 consecutive bit arguments, the first in the lowest bit
+func readBits(buffer *bytes.Buffer) ([8]bool, error) {
+	var bits [8]bool
+
+	octet, err := buffer.ReadByte()
+	if err != nil {
+		return bits, err
+	}
+	for i := range bits {
+		bits[i] = octet&(1<<i) != 0
+	}
+
+	return bits, nil
+}
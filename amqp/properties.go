@@ -0,0 +1,116 @@
+package amqp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	"github.com/resamvi/amqparrot/amqp/client"
+)
+
+// Flags announcing which basic properties follow in a content header, in the order they are sent
+const (
+	flagContentType     uint16 = 1 << 15
+	flagContentEncoding uint16 = 1 << 14
+	flagHeaders         uint16 = 1 << 13
+	flagDeliveryMode    uint16 = 1 << 12
+	flagPriority        uint16 = 1 << 11
+	flagCorrelationID   uint16 = 1 << 10
+	flagReplyTo         uint16 = 1 << 9
+	flagExpiration      uint16 = 1 << 8
+	flagMessageID       uint16 = 1 << 7
+	flagTimestamp       uint16 = 1 << 6
+	flagType            uint16 = 1 << 5
+	flagUserID          uint16 = 1 << 4
+	flagAppID           uint16 = 1 << 3
+	flagClusterID       uint16 = 1 << 2
+)
+
+// readProperties decodes the property flags and the basic properties of a content header
+func readProperties(buf *bytes.Buffer) (client.Properties, error) {
+	var (
+		p     client.Properties
+		flags uint16
+		err   error
+	)
+	if err := binary.Read(buf, binary.BigEndian, &flags); err != nil {
+		return p, err
+	}
+
+	shortStrings := []struct {
+		flag  uint16
+		field *string
+	}{
+		{flagContentType, &p.ContentType},
+		{flagContentEncoding, &p.ContentEncoding},
+	}
+	for _, s := range shortStrings {
+		if flags&s.flag != 0 {
+			if *s.field, err = readShortString(buf); err != nil {
+				return p, err
+			}
+		}
+	}
+
+	if flags&flagHeaders != 0 {
+		if p.Headers, err = readTable(buf); err != nil {
+			return p, err
+		}
+	}
+	if flags&flagDeliveryMode != 0 {
+		if p.DeliveryMode, err = buf.ReadByte(); err != nil {
+			return p, err
+		}
+	}
+	if flags&flagPriority != 0 {
+		if p.Priority, err = buf.ReadByte(); err != nil {
+			return p, err
+		}
+	}
+
+	shortStrings = []struct {
+		flag  uint16
+		field *string
+	}{
+		{flagCorrelationID, &p.CorrelationID},
+		{flagReplyTo, &p.ReplyTo},
+		{flagExpiration, &p.Expiration},
+		{flagMessageID, &p.MessageID},
+	}
+	for _, s := range shortStrings {
+		if flags&s.flag != 0 {
+			if *s.field, err = readShortString(buf); err != nil {
+				return p, err
+			}
+		}
+	}
+
+	if flags&flagTimestamp != 0 {
+		var ts uint64
+		if err := binary.Read(buf, binary.BigEndian, &ts); err != nil {
+			return p, err
+		}
+		t := time.Unix(int64(ts), 0).UTC()
+		p.Timestamp = &t
+	}
+
+	var clusterID string
+	shortStrings = []struct {
+		flag  uint16
+		field *string
+	}{
+		{flagType, &p.Type},
+		{flagUserID, &p.UserID},
+		{flagAppID, &p.AppID},
+		{flagClusterID, &clusterID}, // deprecated, read to stay aligned
+	}
+	for _, s := range shortStrings {
+		if flags&s.flag != 0 {
+			if *s.field, err = readShortString(buf); err != nil {
+				return p, err
+			}
+		}
+	}
+
+	return p, nil
+}
@@ -0,0 +1,47 @@
+package amqp
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+// SASL mechanisms amqparrot understands
+const (
+	MechanismPlain    = "PLAIN"
+	MechanismAMQPlain = "AMQPLAIN"
+	MechanismExternal = "EXTERNAL"
+)
+
+var ErrCredentials = errors.New("malformed credentials")
+
+// ParsePlain decodes a PLAIN response of the form "authzid\x00user\x00pass"
+func ParsePlain(response string) (user, pass string, err error) {
+	creds := strings.Split(response, "\x00")
+	if len(creds) != 3 {
+		return "", "", ErrCredentials
+	}
+
+	return creds[1], creds[2], nil
+}
+
+// ParseAMQPlain decodes an AMQPLAIN response, which is a field table without
+// its length prefix holding LOGIN and PASSWORD.
+// The "LOGIN:userPASSWORD:pass" format of older client libraries is accepted as well.
+func ParseAMQPlain(response string) (user, pass string, err error) {
+	if fields, err := readFields(bytes.NewBufferString(response)); err == nil {
+		user, uok := fields["LOGIN"].(string)
+		pass, pok := fields["PASSWORD"].(string)
+		if uok && pok {
+			return user, pass, nil
+		}
+	}
+
+	if strings.HasPrefix(response, "LOGIN:") {
+		if user, pass, ok := strings.Cut(strings.TrimPrefix(response, "LOGIN:"), "PASSWORD:"); ok {
+			return user, pass, nil
+		}
+	}
+
+	return "", "", ErrCredentials
+}
@@ -1,22 +1,29 @@
 package server
 
 import (
+	"encoding/binary"
 	"github.com/resamvi/amqparrot/amqp"
 	"reflect"
+	"runtime"
 	"strings"
+	"unicode/utf8"
 )
 
 var (
-	// ConnectionStart is the answer to "hello" sent to client
-	ConnectionStart []byte
-	// ConnectionTune is the answer to "ConnectionStartOk" sent to client
-	ConnectionTune []byte
 	// ConnectionOpenOk is the answer to "ConnectionTuneOk" sent to client
 	ConnectionOpenOk []byte
+	// ConnectionCloseOk is the answer to "ConnectionClose" sent to client
+	ConnectionCloseOk []byte
+	// Heartbeat is sent periodically to clients that negotiated heartbeats
+	Heartbeat []byte
+	// ConnectionUnblocked lifts a previous ConnectionBlocked
+	ConnectionUnblocked []byte
 )
 
-func init() {
-	ConnectionStart = MarshalBinary(amqp.ConnectionStart{
+// ConnectionStart is the answer to "hello" sent to client offering the space separated SASL `mechanisms`
+func ConnectionStart(mechanisms string) []byte {
+	const locale = "en_US"
+	start := MarshalBinary(amqp.ConnectionStart{
 		Type:         amqp.TypeMethod,
 		Channel:      amqp.GlobalChannel,
 		Length:       0, // rewritten later
@@ -24,7 +31,7 @@ func init() {
 		Method:       amqp.MethodConnectionStart,
 		MajorVersion: 0,
 		MinorVersion: 9,
-		MapLength:    327, // hardcoded size: I cba to implement nested parsing to calculate size of payload
+		MapLength:    0, // rewritten below
 		Capabilities: []string{
 			"publisher_confirms",
 			"exchange_exchange_bindings",
@@ -38,23 +45,20 @@ func init() {
 		},
 		Name:        "amqparrot",
 		Information: "MIT License - Copyright (c) 2022 Julien Midedji",
-		Version:     "1.0.0 (go1.18)",
-		Auth:        "AMQPLAIN PLAIN",
-		Locale:      "en_US",
+		Version:     "1.0.0 (" + runtime.Version() + ")",
+		Auth:        amqp.LongString(mechanisms),
+		Locale:      locale,
 	})
 
-	ConnectionTune = MarshalBinary(amqp.ConnectionTune{
-		Type:       amqp.TypeMethod,
-		Channel:    amqp.GlobalChannel,
-		Length:     0, // rewritten later
-		Class:      amqp.ClassConnection,
-		Method:     amqp.MethodConnectionTune,
-		ArgLength:  7, // hardcoded size
-		ChannelMax: 1<<16 - 256,
-		FrameMax:   1 << 25,
-		Heartbeat:  60,
-	})
+	// the server properties table ends where the long strings of mechanisms and locale start
+	const tableStart = 17
+	tableEnd := len(start) - 1 - (4 + len(locale)) - (4 + len(mechanisms))
+	binary.BigEndian.PutUint32(start[tableStart-4:], uint32(tableEnd-tableStart))
 
+	return start
+}
+
+func init() {
 	ConnectionOpenOk = MarshalBinary(amqp.ConnectionOpenOk{
 		Type:     amqp.TypeMethod,
 		Channel:  amqp.GlobalChannel,
@@ -63,6 +67,82 @@ func init() {
 		Method:   amqp.MethodConnectionOpenOk,
 		Reserved: 0,
 	})
+
+	ConnectionCloseOk = MarshalBinary(amqp.Empty{
+		Type:    amqp.TypeMethod,
+		Channel: amqp.GlobalChannel,
+		Length:  0, // rewritten later
+		Class:   amqp.ClassConnection,
+		Method:  amqp.MethodConnectionCloseOk,
+	})
+
+	ConnectionUnblocked = MarshalBinary(amqp.Empty{
+		Type:    amqp.TypeMethod,
+		Channel: amqp.GlobalChannel,
+		Length:  0, // rewritten later
+		Class:   amqp.ClassConnection,
+		Method:  amqp.MethodConnectionUnblock,
+	})
+
+	Heartbeat = MarshalBinary(amqp.Heartbeat{
+		Type:    amqp.TypeHeartbeat,
+		Channel: amqp.GlobalChannel,
+		Length:  0,
+	})
+}
+
+// ConnectionSecure asks the client to answer `challenge` with connection.secure-ok
+func ConnectionSecure(challenge string) []byte {
+	return MarshalBinary(amqp.ConnectionSecure{
+		Type:      amqp.TypeMethod,
+		Channel:   amqp.GlobalChannel,
+		Length:    0, // rewritten later
+		Class:     amqp.ClassConnection,
+		Method:    amqp.MethodConnectionSecure,
+		Challenge: amqp.LongString(challenge),
+	})
+}
+
+// ConnectionTune is the answer to "ConnectionStartOk" sent to client.
+// A heartbeat of 0 tells the client that the server does not want heartbeats.
+func ConnectionTune(channelMax uint16, frameMax uint32, heartbeat uint16) []byte {
+	return MarshalBinary(amqp.ConnectionTune{
+		Type:       amqp.TypeMethod,
+		Channel:    amqp.GlobalChannel,
+		Length:     0, // rewritten later
+		Class:      amqp.ClassConnection,
+		Method:     amqp.MethodConnectionTune,
+		ChannelMax: channelMax,
+		FrameMax:   frameMax,
+		Heartbeat:  heartbeat,
+	})
+}
+
+// ConnectionClose tells the client that the server closes the connection because of an error
+func ConnectionClose(code uint16, text string, class, method uint16) []byte {
+	return MarshalBinary(amqp.ConnectionClose{
+		Type:      amqp.TypeMethod,
+		Channel:   amqp.GlobalChannel,
+		Length:    0, // rewritten later
+		Class:     amqp.ClassConnection,
+		Method:    amqp.MethodConnectionClose,
+		ReplyCode: code,
+		ReplyText: amqp.ShortString(text),
+		ClassID:   class,
+		MethodID:  method,
+	})
+}
+
+// ConnectionBlocked tells the client to stop publishing because of `reason`
+func ConnectionBlocked(reason string) []byte {
+	return MarshalBinary(amqp.ConnectionBlocked{
+		Type:    amqp.TypeMethod,
+		Channel: amqp.GlobalChannel,
+		Length:  0, // rewritten later
+		Class:   amqp.ClassConnection,
+		Method:  amqp.MethodConnectionBlocked,
+		Reason:  amqp.ShortString(reason),
+	})
 }
 
 func ChannelOpen(channel uint16) []byte {
@@ -76,24 +156,144 @@ func ChannelOpen(channel uint16) []byte {
 }
 
 func ChannelClose(channel uint16) []byte {
-	return MarshalBinary(amqp.Generic{
-		Type:     amqp.TypeMethod,
-		Channel:  channel,
-		Length:   0, // rewritten later
-		Class:    amqp.ClassChannel,
-		Method:   amqp.MethodChannelCloseOk,
-		Reserved: 0,
+	return MarshalBinary(amqp.Empty{
+		Type:    amqp.TypeMethod,
+		Channel: channel,
+		Length:  0, // rewritten later
+		Class:   amqp.ClassChannel,
+		Method:  amqp.MethodChannelCloseOk,
+	})
+}
+
+// ChannelCloseWith tells the client that the server closes `channel` because of an error
+func ChannelCloseWith(channel, code uint16, text string, class, method uint16) []byte {
+	return MarshalBinary(amqp.ChannelClose{
+		Type:      amqp.TypeMethod,
+		Channel:   channel,
+		Length:    0, // rewritten later
+		Class:     amqp.ClassChannel,
+		Method:    amqp.MethodChannelClose,
+		ReplyCode: code,
+		ReplyText: amqp.ShortString(text),
+		ClassID:   class,
+		MethodID:  method,
+	})
+}
+
+// ChannelFlow asks the client to stop (active=false) or resume publishing on `channel`
+func ChannelFlow(channel uint16, active bool) []byte {
+	return channelFlow(channel, amqp.MethodChannelFlow, active)
+}
+
+// ChannelFlowOk confirms a channel.flow sent by the client
+func ChannelFlowOk(channel uint16, active bool) []byte {
+	return channelFlow(channel, amqp.MethodChannelFlowOk, active)
+}
+
+func channelFlow(channel, method uint16, active bool) []byte {
+	var flag uint8
+	if active {
+		flag = 1
+	}
+
+	return MarshalBinary(amqp.ChannelFlow{
+		Type:    amqp.TypeMethod,
+		Channel: channel,
+		Length:  0, // rewritten later
+		Class:   amqp.ClassChannel,
+		Method:  method,
+		Active:  flag,
 	})
 }
 
 func ExchangeDeclareOk(channel uint16) []byte {
-	return MarshalBinary(amqp.Generic{
-		Type:     amqp.TypeMethod,
-		Channel:  channel,
-		Length:   0, // rewritten later
-		Class:    amqp.ClassExchange,
-		Method:   amqp.MethodExchangeDeclareOk,
-		Reserved: 0,
+	return MarshalBinary(amqp.Empty{
+		Type:    amqp.TypeMethod,
+		Channel: channel,
+		Length:  0, // rewritten later
+		Class:   amqp.ClassExchange,
+		Method:  amqp.MethodExchangeDeclareOk,
+	})
+}
+
+// ExchangeDeleteOk confirms a deleted exchange
+func ExchangeDeleteOk(channel uint16) []byte {
+	return empty(channel, amqp.ClassExchange, amqp.MethodExchangeDeleteOk)
+}
+
+// QueueDeclareOk confirms a declared queue with the number of its messages and consumers
+func QueueDeclareOk(channel uint16, queue string, messages, consumers uint32) []byte {
+	return MarshalBinary(amqp.QueueDeclareOk{
+		Type:          amqp.TypeMethod,
+		Channel:       channel,
+		Length:        0, // rewritten later
+		Class:         amqp.ClassQueue,
+		Method:        amqp.MethodQueueDeclareOk,
+		Queue:         amqp.ShortString(queue),
+		MessageCount:  messages,
+		ConsumerCount: consumers,
+	})
+}
+
+// QueueBindOk confirms a binding
+func QueueBindOk(channel uint16) []byte {
+	return empty(channel, amqp.ClassQueue, amqp.MethodQueueBindOk)
+}
+
+// QueueUnbindOk confirms a removed binding
+func QueueUnbindOk(channel uint16) []byte {
+	return empty(channel, amqp.ClassQueue, amqp.MethodQueueUnbindOk)
+}
+
+// QueuePurgeOk confirms a purge with the number of dropped messages
+func QueuePurgeOk(channel uint16, messages uint32) []byte {
+	return messageCount(channel, amqp.MethodQueuePurgeOk, messages)
+}
+
+// QueueDeleteOk confirms a deleted queue with the number of messages it held
+func QueueDeleteOk(channel uint16, messages uint32) []byte {
+	return messageCount(channel, amqp.MethodQueueDeleteOk, messages)
+}
+
+// BasicConsumeOk confirms a consumer with its tag
+func BasicConsumeOk(channel uint16, tag string) []byte {
+	return consumerTag(channel, amqp.MethodBasicConsumeOk, tag)
+}
+
+// BasicCancelOk confirms a cancelled consumer
+func BasicCancelOk(channel uint16, tag string) []byte {
+	return consumerTag(channel, amqp.MethodBasicCancelOk, tag)
+}
+
+func consumerTag(channel, method uint16, tag string) []byte {
+	return MarshalBinary(amqp.ConsumerTag{
+		Type:        amqp.TypeMethod,
+		Channel:     channel,
+		Length:      0, // rewritten later
+		Class:       amqp.ClassBasic,
+		Method:      method,
+		ConsumerTag: amqp.ShortString(tag),
+	})
+}
+
+func messageCount(channel, method uint16, messages uint32) []byte {
+	return MarshalBinary(amqp.MessageCount{
+		Type:         amqp.TypeMethod,
+		Channel:      channel,
+		Length:       0, // rewritten later
+		Class:        amqp.ClassQueue,
+		Method:       method,
+		MessageCount: messages,
+	})
+}
+
+func empty(channel, class, method uint16) []byte {
+	return MarshalBinary(amqp.Empty{
+		Type:    amqp.TypeMethod,
+		Channel: channel,
+		Length:  0, // rewritten later
+		Class:   class,
+		Method:  method,
 	})
 }
 
@@ -113,6 +313,10 @@ func MarshalBinary[T any](strct T) []byte {
 			data = append(data, byte(value>>8), byte(value))
 		case uint32:
 			data = append(data, byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+		case amqp.ShortString:
+			value = truncate(value)
+			data = append(data, byte(len(value)))
+			data = append(data, []byte(value)...)
 		case amqp.LongString:
 			valueLength := len(value)
 			data = append(data, byte(valueLength>>24), byte(valueLength>>16), byte(valueLength>>8), byte(valueLength))
@@ -157,3 +361,20 @@ func MarshalBinary[T any](strct T) []byte {
 
 	return data
 }
+
+// maxShortString is the most bytes a short string can hold
+const maxShortString = 255
+
+// truncate cuts `s` to fit into a short string without splitting a UTF-8 sequence
+func truncate(s amqp.ShortString) amqp.ShortString {
+	if len(s) <= maxShortString {
+		return s
+	}
+
+	end := maxShortString
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+
+	return s[:end]
+}
@@ -0,0 +1,158 @@
+package amqp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Decimal is the decimal-value field type: Value / 10^Scale
+type Decimal struct {
+	Scale uint8
+	Value int32
+}
+
+func readShortString(buf *bytes.Buffer) (string, error) {
+	var size uint8
+	if err := binary.Read(buf, binary.BigEndian, &size); err != nil {
+		return "", err
+	}
+
+	str := make([]byte, size)
+	if _, err := io.ReadFull(buf, str); err != nil {
+		return "", err
+	}
+
+	return string(str), nil
+}
+
+func readLongString(buf *bytes.Buffer) (string, error) {
+	var size uint32
+	if err := binary.Read(buf, binary.BigEndian, &size); err != nil {
+		return "", err
+	}
+	if int(size) > buf.Len() {
+		return "", io.ErrUnexpectedEOF
+	}
+
+	return string(buf.Next(int(size))), nil
+}
+
+// readTable decodes a field table including its length prefix
+func readTable(buf *bytes.Buffer) (map[string]any, error) {
+	raw, err := readLongString(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return readFields(bytes.NewBufferString(raw))
+}
+
+// readFields decodes the name-value pairs of a field table until buf is empty
+func readFields(buf *bytes.Buffer) (map[string]any, error) {
+	table := make(map[string]any)
+	for buf.Len() > 0 {
+		name, err := readShortString(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := readField(buf)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", name, err)
+		}
+		table[name] = value
+	}
+
+	return table, nil
+}
+
+// readField decodes a single field value prefixed by its type octet
+// Types follow the RabbitMQ errata for 0-9-1.
+func readField(buf *bytes.Buffer) (any, error) {
+	typ, err := buf.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch typ {
+	case 't':
+		var v uint8
+		err = binary.Read(buf, binary.BigEndian, &v)
+		return v != 0, err
+	case 'b':
+		var v int8
+		err = binary.Read(buf, binary.BigEndian, &v)
+		return v, err
+	case 'B':
+		var v uint8
+		err = binary.Read(buf, binary.BigEndian, &v)
+		return v, err
+	case 's':
+		var v int16
+		err = binary.Read(buf, binary.BigEndian, &v)
+		return v, err
+	case 'u':
+		var v uint16
+		err = binary.Read(buf, binary.BigEndian, &v)
+		return v, err
+	case 'I':
+		var v int32
+		err = binary.Read(buf, binary.BigEndian, &v)
+		return v, err
+	case 'i':
+		var v uint32
+		err = binary.Read(buf, binary.BigEndian, &v)
+		return v, err
+	case 'l':
+		var v int64
+		err = binary.Read(buf, binary.BigEndian, &v)
+		return v, err
+	case 'f':
+		var v float32
+		err = binary.Read(buf, binary.BigEndian, &v)
+		return v, err
+	case 'd':
+		var v float64
+		err = binary.Read(buf, binary.BigEndian, &v)
+		return v, err
+	case 'D':
+		var v Decimal
+		err = binary.Read(buf, binary.BigEndian, &v)
+		return v, err
+	case 'S':
+		return readLongString(buf)
+	case 'x':
+		v, err := readLongString(buf)
+		return []byte(v), err
+	case 'T':
+		var v uint64
+		err = binary.Read(buf, binary.BigEndian, &v)
+		return time.Unix(int64(v), 0).UTC(), err
+	case 'F':
+		return readTable(buf)
+	case 'A':
+		raw, err := readLongString(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		items := bytes.NewBufferString(raw)
+		array := make([]any, 0)
+		for items.Len() > 0 {
+			item, err := readField(items)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, item)
+		}
+
+		return array, nil
+	case 'V':
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unknown field type %q", typ)
+}
@@ -0,0 +1,29 @@
+package amqp
+
+import "strings"
+
+// MatchTopic reports whether `routingKey` matches the topic exchange binding `pattern`,
+// where words are separated by dots, `*` matches exactly one word and `#` zero or more words.
+func MatchTopic(pattern, routingKey string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(routingKey, "."))
+}
+
+func matchWords(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if matchWords(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && matchWords(pattern[1:], words[1:])
+	}
+
+	return len(words) > 0 && pattern[0] == words[0] && matchWords(pattern[1:], words[1:])
+}
@@ -11,24 +11,50 @@ const (
 	ClassConnection uint16 = 10
 	ClassChannel    uint16 = 20
 	ClassExchange   uint16 = 40
+	ClassQueue      uint16 = 50
 	ClassBasic      uint16 = 60
 
-	MethodConnectionStart   uint16 = 10
-	MethodConnectionStartOk uint16 = 11
-	MethodConnectionTune    uint16 = 30
-	MethodConnectionTuneOk  uint16 = 31
-	MethodConnectionOpen    uint16 = 40
-	MethodConnectionOpenOk  uint16 = 41
+	MethodConnectionStart    uint16 = 10
+	MethodConnectionStartOk  uint16 = 11
+	MethodConnectionSecure   uint16 = 20
+	MethodConnectionSecureOk uint16 = 21
+	MethodConnectionTune     uint16 = 30
+	MethodConnectionTuneOk   uint16 = 31
+	MethodConnectionOpen     uint16 = 40
+	MethodConnectionOpenOk   uint16 = 41
+	MethodConnectionClose    uint16 = 50
+	MethodConnectionCloseOk  uint16 = 51
+	MethodConnectionBlocked  uint16 = 60
+	MethodConnectionUnblock  uint16 = 61
 
 	MethodChannelOpen    uint16 = 10
 	MethodChannelOpenOk  uint16 = 11
+	MethodChannelFlow    uint16 = 20
+	MethodChannelFlowOk  uint16 = 21
 	MethodChannelClose   uint16 = 40
 	MethodChannelCloseOk uint16 = 41
 
 	MethodExchangeDeclare   uint16 = 10
 	MethodExchangeDeclareOk uint16 = 11
+	MethodExchangeDelete    uint16 = 20
+	MethodExchangeDeleteOk  uint16 = 21
 
-	MethodBasicPublish uint16 = 40
+	MethodQueueDeclare   uint16 = 10
+	MethodQueueDeclareOk uint16 = 11
+	MethodQueueBind      uint16 = 20
+	MethodQueueBindOk    uint16 = 21
+	MethodQueuePurge     uint16 = 30
+	MethodQueuePurgeOk   uint16 = 31
+	MethodQueueDelete    uint16 = 40
+	MethodQueueDeleteOk  uint16 = 41
+	MethodQueueUnbind    uint16 = 50
+	MethodQueueUnbindOk  uint16 = 51
+
+	MethodBasicConsume   uint16 = 20
+	MethodBasicConsumeOk uint16 = 21
+	MethodBasicCancel    uint16 = 30
+	MethodBasicCancelOk  uint16 = 31
+	MethodBasicPublish   uint16 = 40
 )
 
 const (
@@ -39,12 +65,31 @@ const (
 	EndMark uint8 = 206
 )
 
+// Reply codes sent with connection.close and channel.close
+const (
+	ReplySuccess       uint16 = 200
+	ConnectionForced   uint16 = 320
+	AccessRefused      uint16 = 403
+	NotFound           uint16 = 404
+	ResourceLocked     uint16 = 405
+	PreconditionFailed uint16 = 406
+	FrameError         uint16 = 501
+	SyntaxError        uint16 = 502
+	CommandInvalid     uint16 = 503
+	ChannelError       uint16 = 504
+	UnexpectedFrame    uint16 = 505
+	NotAllowed         uint16 = 530
+	NotImplemented     uint16 = 540
+	InternalError      uint16 = 541
+)
+
 var (
 	Hello = []byte{'A', 'M', 'Q', 'P', 0, MajorVersion, MinorVersion, RevisionVersion}
 )
 
 type (
-	LongString string
+	ShortString string
+	LongString  string
 
 	// ConnectionStart is sent by the server
 	ConnectionStart struct {
@@ -64,6 +109,16 @@ type (
 		Locale       LongString
 	}
 
+	// ConnectionSecure challenges the client for more SASL data
+	ConnectionSecure struct {
+		Type      uint8
+		Channel   uint16
+		Length    uint32
+		Class     uint16
+		Method    uint16
+		Challenge LongString
+	}
+
 	// ConnectionTune is sent by the server
 	ConnectionTune struct {
 		Type       uint8
@@ -71,10 +126,16 @@ type (
 		Length     uint32
 		Class      uint16
 		Method     uint16
-		ArgLength  uint8 // cba see above
 		ChannelMax uint16
 		FrameMax   uint32
-		Heartbeat  uint8 // 8-bit not really what spec defines *shrug*
+		Heartbeat  uint16
+	}
+
+	// Heartbeat is sent by either peer to signal that it is still alive
+	Heartbeat struct {
+		Type    uint8
+		Channel uint16
+		Length  uint32
 	}
 
 	ConnectionOpenOk struct {
@@ -86,7 +147,94 @@ type (
 		Reserved uint8
 	}
 
-	// used for channelOpenOk, channelCloseOk, exchangeDeclareOk
+	// ConnectionClose is sent by the server when the client violated the protocol
+	ConnectionClose struct {
+		Type      uint8
+		Channel   uint16
+		Length    uint32
+		Class     uint16
+		Method    uint16
+		ReplyCode uint16
+		ReplyText ShortString
+		ClassID   uint16
+		MethodID  uint16
+	}
+
+	// ConnectionBlocked tells the client to stop publishing
+	ConnectionBlocked struct {
+		Type    uint8
+		Channel uint16
+		Length  uint32
+		Class   uint16
+		Method  uint16
+		Reason  ShortString
+	}
+
+	// ChannelClose is sent by the server when the client caused a channel error
+	ChannelClose struct {
+		Type      uint8
+		Channel   uint16
+		Length    uint32
+		Class     uint16
+		Method    uint16
+		ReplyCode uint16
+		ReplyText ShortString
+		ClassID   uint16
+		MethodID  uint16
+	}
+
+	// used for channelFlow and channelFlowOk
+	ChannelFlow struct {
+		Type    uint8
+		Channel uint16
+		Length  uint32
+		Class   uint16
+		Method  uint16
+		Active  uint8
+	}
+
+	// QueueDeclareOk confirms a declared queue, which may have been named by the server
+	QueueDeclareOk struct {
+		Type          uint8
+		Channel       uint16
+		Length        uint32
+		Class         uint16
+		Method        uint16
+		Queue         ShortString
+		MessageCount  uint32
+		ConsumerCount uint32
+	}
+
+	// used for queuePurgeOk and queueDeleteOk
+	MessageCount struct {
+		Type         uint8
+		Channel      uint16
+		Length       uint32
+		Class        uint16
+		Method       uint16
+		MessageCount uint32
+	}
+
+	// used for basicConsumeOk and basicCancelOk
+	ConsumerTag struct {
+		Type        uint8
+		Channel     uint16
+		Length      uint32
+		Class       uint16
+		Method      uint16
+		ConsumerTag ShortString
+	}
+
+	// used for methods without arguments like connectionCloseOk, channelCloseOk, exchangeDeclareOk
+	Empty struct {
+		Type    uint8
+		Channel uint16
+		Length  uint32
+		Class   uint16
+		Method  uint16
+	}
+
+	// used for channelOpenOk
 	Generic struct {
 		Type     uint8
 		Channel  uint16
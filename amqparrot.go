@@ -1,34 +1,181 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
+	"github.com/resamvi/amqparrot/capture"
+	"github.com/resamvi/amqparrot/content"
 	"github.com/resamvi/amqparrot/server"
+	"io"
 	"log"
+	"log/slog"
+	"math"
 	"os"
 	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func usage() {
 	fmt.Fprintf(os.Stdout, `usage: amqparrot [flags]
+       amqparrot replay [flags] <FILE>
+       amqparrot pcap [flags] <FRAMES> <OUT>
+       amqparrot definitions [flags] [OUT]
+       amqparrot tui [flags]
 	-h, --help          show this help
 	-v, --version       show version
 	-p, --port <PORT>   specify on which port to listen
+	--heartbeat <SECS>  heartbeat interval suggested to clients, 0 disables (default 60)
+	--channel-max <N>   highest channel id clients may use (default 2047)
+	--frame-max <BYTES> largest frame clients may send (default 131072)
+	--format <FORMAT>   log format, text, json or logfmt (default text)
+	--raw               log bodies as received instead of rendering them by content type
+	--body-limit <N>    cut off bodies after N characters, 0 disables (default 1000 on a terminal, 0 otherwise)
+	--no-color          do not color the output on a terminal, also disabled by setting NO_COLOR
+	--proto-descriptors <FILE>
+	                    decode protobuf bodies with this FileDescriptorSet
+	--proto-mapping <FILE>
+	                    JSON file mapping exchanges, routing keys and types to protobuf messages
+	--record <FILE>     append every received message to this JSON Lines file
+	--frames <FILE>     append every frame read and written to this JSON Lines file, see pcap
+	--trace             log every frame read and written, decoded and as hex dump
+	--exchange <NAME>   only log events of this exchange, may be repeated
+	--routing-key <PATTERN>
+	                    only log messages whose routing key matches this topic pattern, may be repeated
+	--vhost <VHOST>     only log events of this vhost, may be repeated
+	--user <USER>       only log events of this user, may be repeated
+	--header <NAME[=VALUE]>
+	                    only log messages carrying this header, may be repeated
+	--exclude-exchange, --exclude-routing-key, --exclude-vhost, --exclude-user, --exclude-header
+	                    hide the events the respective option above would select
+	--no-chatter        hide connection and channel events unless they report a problem
+	--http <ADDR>       serve the HTTP API and web UI on this address, e.g. :8081
+	--users <FILE>      only accept users from this JSON file (default: accept any login)
+	--definitions <FILE>
+	                    load vhosts, exchanges, queues, bindings, users and permissions
+	                    from a RabbitMQ definitions export at startup
+	--tls-port <PORT>   additionally listen for amqps connections on this port
+	--tls-cert <FILE>   PEM certificate of the amqps listener
+	--tls-key <FILE>    PEM private key of the amqps listener
+	--tls-ca <FILE>     PEM CA verifying client certificates for the EXTERNAL mechanism
 `)
 }
 
 var (
-	port        int
-	showVersion bool
+	port            int
+	heartbeat       int
+	channelMax      = bounded{max: math.MaxUint16}
+	frameMax        = bounded{max: math.MaxUint32}
+	format          string
+	rawBodies       bool
+	bodyLimit       int
+	noColor         bool
+	protoSet        string
+	protoMap        string
+	recordFile      string
+	framesFile      string
+	trace           bool
+	httpAddr        string
+	usersFile       string
+	definitionsFile string
+	tlsPort         int
+	tlsCert         string
+	tlsKey          string
+	tlsCA           string
+	showVersion     bool
+	interactive     bool
+	filter          server.Filter
+	headers         list
+	exclHeaders     list
 )
 
+// bounded is an unsigned flag refusing values above max, which would wrap in the protocol field
+type bounded struct {
+	value uint64
+	max   uint64
+}
+
+func (b *bounded) String() string { return strconv.FormatUint(b.value, 10) }
+
+func (b *bounded) Set(value string) error {
+	v, err := strconv.ParseUint(value, 0, 64)
+	if err != nil || v > b.max {
+		return fmt.Errorf("must be a number between 0 and %v", b.max)
+	}
+	b.value = v
+	return nil
+}
+
+// list collects the values of a flag given several times
+type list []string
+
+func (l *list) String() string { return strings.Join(*l, ",") }
+
+func (l *list) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 const (
-	defaultPort = 8080
+	defaultPort      = 8080
+	defaultHeartbeat = 60
+	defaultBodyLimit = 1000
+
+	// formatLogfmt logs key=value pairs through log/slog
+	formatLogfmt = "logfmt"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			os.Exit(replay(os.Args[2:]))
+		case "pcap":
+			os.Exit(pcap(os.Args[2:]))
+		case "definitions":
+			os.Exit(definitions(os.Args[2:]))
+		case "tui":
+			// the terminal UI takes the same flags and shows what would be logged
+			interactive = true
+			os.Args = append(os.Args[:1:1], os.Args[2:]...)
+		}
+	}
+
 	flag.IntVar(&port, "port", defaultPort, "")
 	flag.IntVar(&port, "p", defaultPort, "")
+	flag.IntVar(&heartbeat, "heartbeat", defaultHeartbeat, "")
+	flag.Var(&channelMax, "channel-max", "")
+	flag.Var(&frameMax, "frame-max", "")
+	flag.StringVar(&format, "format", server.FormatText, "")
+	flag.BoolVar(&rawBodies, "raw", false, "")
+	flag.IntVar(&bodyLimit, "body-limit", -1, "")
+	flag.BoolVar(&noColor, "no-color", false, "")
+	flag.StringVar(&protoSet, "proto-descriptors", "", "")
+	flag.StringVar(&protoMap, "proto-mapping", "", "")
+	flag.StringVar(&httpAddr, "http", "", "")
+	flag.StringVar(&usersFile, "users", "", "")
+	flag.StringVar(&definitionsFile, "definitions", "", "")
+	flag.IntVar(&tlsPort, "tls-port", 0, "")
+	flag.StringVar(&tlsCert, "tls-cert", "", "")
+	flag.StringVar(&tlsKey, "tls-key", "", "")
+	flag.StringVar(&tlsCA, "tls-ca", "", "")
+	flag.StringVar(&recordFile, "record", "", "")
+	flag.StringVar(&framesFile, "frames", "", "")
+	flag.BoolVar(&trace, "trace", false, "")
+	flag.Var((*list)(&filter.Exchanges), "exchange", "")
+	flag.Var((*list)(&filter.ExcludeExchanges), "exclude-exchange", "")
+	flag.Var((*list)(&filter.RoutingKeys), "routing-key", "")
+	flag.Var((*list)(&filter.ExcludeRoutingKeys), "exclude-routing-key", "")
+	flag.Var((*list)(&filter.VHosts), "vhost", "")
+	flag.Var((*list)(&filter.ExcludeVHosts), "exclude-vhost", "")
+	flag.Var((*list)(&filter.Users), "user", "")
+	flag.Var((*list)(&filter.ExcludeUsers), "exclude-user", "")
+	flag.Var(&headers, "header", "")
+	flag.Var(&exclHeaders, "exclude-header", "")
+	flag.BoolVar(&filter.NoChatter, "no-chatter", false, "")
 	flag.BoolVar(&showVersion, "version", false, "")
 	flag.BoolVar(&showVersion, "v", false, "")
 
@@ -42,10 +189,149 @@ func main() {
 	}
 
 	srv := server.Server{
-		Port: port,
-		Log:  log.New(os.Stdout, "", log.LstdFlags),
+		Port:       port,
+		Log:        log.New(os.Stdout, "", log.LstdFlags),
+		Heartbeat:  time.Duration(heartbeat) * time.Second,
+		ChannelMax: uint16(channelMax.value),
+		FrameMax:   uint32(frameMax.value),
+		Format:     format,
+		RawBodies:  rawBodies,
+		Trace:      trace,
+		Filter:     filter,
+		HTTPAddr:   httpAddr,
+	}
+	srv.Filter.Headers = headerValues(headers)
+	srv.Filter.ExcludeHeaders = headerValues(exclHeaders)
+	switch format {
+	case server.FormatJSON:
+		srv.Log = log.New(os.Stdout, "", 0) // events carry their own timestamp
+	case formatLogfmt:
+		srv.Handler = logfmtHandler(os.Stdout, trace)
+		srv.Format = ""
+	}
+	if format == server.FormatText && isTerminal(os.Stdout) {
+		srv.Log = log.New(os.Stdout, "", 0) // aligned output prints its own timestamps
+		srv.Pretty = true
+		srv.Color = !noColor && os.Getenv("NO_COLOR") == ""
+	}
+	srv.BodyLimit = bodyLimit
+	if bodyLimit < 0 {
+		srv.BodyLimit = 0
+		if srv.Pretty {
+			srv.BodyLimit = defaultBodyLimit
+		}
+	}
+	if heartbeat == 0 {
+		srv.Heartbeat = -1 // disabled
+	}
+	if usersFile != "" {
+		users, err := server.LoadUsers(usersFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		srv.Users = users
+	}
+	if definitionsFile != "" {
+		topology, err := server.LoadDefinitions(definitionsFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		srv.Preload = topology
+	}
+	if protoSet != "" {
+		proto, err := content.LoadProtobuf(protoSet, protoMap)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		srv.Protobuf = proto
+	}
+	if recordFile != "" {
+		file, err := os.OpenFile(recordFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: could not open record file: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		srv.Record = capture.NewWriter(file)
 	}
-	if err := srv.Start(); err != nil {
+	if framesFile != "" {
+		file, err := os.OpenFile(framesFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: could not open frames file: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		srv.Frames = capture.NewFrameWriter(file)
+	}
+	if tlsPort != 0 {
+		config, err := tlsConfig(tlsCert, tlsKey, tlsCA)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		srv.TLSPort = tlsPort
+		srv.TLSConfig = config
+	}
+	start := srv.Start
+	if interactive {
+		start = func() error { return runTUI(&srv) }
+	}
+	if err := start(); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 	}
 }
+
+// logfmtHandler logs in logfmt to `w`, including the debug level events of --trace if `trace` is set
+func logfmtHandler(w io.Writer, trace bool) slog.Handler {
+	opts := &slog.HandlerOptions{}
+	if trace {
+		opts.Level = slog.LevelDebug
+	}
+
+	return slog.NewTextHandler(w, opts)
+}
+
+// isTerminal reports whether `file` is a terminal rather than a pipe or regular file
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// headerValues splits header filters of the form name=value and collects the values given for each name;
+// a missing value matches any value
+func headerValues(filters []string) map[string][]string {
+	values := make(map[string][]string, len(filters))
+	for _, f := range filters {
+		name, value, _ := strings.Cut(f, "=")
+		values[name] = append(values[name], value)
+	}
+
+	return values
+}
+
+// tlsConfig loads the certificate of the amqps listener and optionally a CA to verify client certificates
+func tlsConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load TLS certificate: %w", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if caFile != "" {
+		ca, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read TLS CA: %w", err)
+		}
+
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %v", caFile)
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return config, nil
+}
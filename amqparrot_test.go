@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/resamvi/amqparrot/amqp"
+	"github.com/resamvi/amqparrot/server"
+)
+
+// syncBuffer is a log that the server writes to while the test reads it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+func TestLogfmtTrace(t *testing.T) {
+	buf := new(syncBuffer)
+	srv := server.Server{
+		Handler: logfmtHandler(buf, true),
+		Trace:   true,
+	}
+	go srv.Start()
+
+	deadline := time.Now().Add(time.Second)
+	for srv.Addr() == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if srv.Addr() == nil {
+		t.Fatal("server did not start within 1s")
+	}
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write(amqp.Hello)
+
+	for !strings.Contains(buf.String(), "level=DEBUG") || !strings.Contains(buf.String(), "event=frame.trace") {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected traced frames at debug level, got:\n%v", buf)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var untraced bytes.Buffer
+	if logfmtHandler(&untraced, false).Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("expected debug level to be disabled without --trace")
+	}
+}
+
+func TestBounded(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		expected uint64
+		valid    bool
+	}{
+		{"2047", 2047, true},
+		{"0x10", 16, true},
+		{"65535", 65535, true},
+		{"65536", 0, false},
+		{"-1", 0, false},
+		{"many", 0, false},
+	} {
+		b := bounded{max: math.MaxUint16}
+		err := b.Set(tc.input)
+		if (err == nil) != tc.valid || b.value != tc.expected {
+			t.Errorf("%v: expected %v (valid %v), got %v (%v)", tc.input, tc.expected, tc.valid, b.value, err)
+		}
+	}
+}
+
+func TestHeaderValues(t *testing.T) {
+	values := headerValues([]string{"tenant=acme", "tenant=globex", "trace"})
+	expected := map[string][]string{"tenant": {"acme", "globex"}, "trace": {""}}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+}
@@ -0,0 +1,78 @@
+// Package capture stores received messages in JSON Lines files and replays them
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/resamvi/amqparrot/amqp/client"
+)
+
+// Message is a received message as stored in one line of a capture file
+type Message struct {
+	Time       time.Time         `json:"timestamp"`
+	VHost      string            `json:"vhost"`
+	Exchange   string            `json:"exchange"`
+	RoutingKey string            `json:"routing_key"`
+	Properties client.Properties `json:"properties"`
+	// Body exactly as received, base64 encoded in the file
+	Body []byte `json:"body"`
+}
+
+// Writer appends messages to a capture file
+type Writer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{enc: json.NewEncoder(w)}
+}
+
+// Write appends `m` as a single line; it is safe to call from several connections
+func (w *Writer) Write(m Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.enc.Encode(m)
+}
+
+// Reader reads messages from a capture file
+type Reader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// maxLine is the longest line a Reader accepts
+const maxLine = 128 << 20
+
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLine)
+
+	return &Reader{scanner: scanner}
+}
+
+// Read returns the next message and io.EOF after the last one. Empty lines are skipped.
+func (r *Reader) Read() (Message, error) {
+	var m Message
+	for r.scanner.Scan() {
+		r.line++
+		if len(r.scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(r.scanner.Bytes(), &m); err != nil {
+			return m, fmt.Errorf("line %v: %w", r.line, err)
+		}
+		return m, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return m, err
+	}
+
+	return m, io.EOF
+}
@@ -0,0 +1,300 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	parser "github.com/resamvi/amqparrot/amqp"
+	"github.com/resamvi/amqparrot/amqp/client"
+	"github.com/streadway/amqp"
+)
+
+func TestHeaderTypes(t *testing.T) {
+	stamp := time.Date(2022, 5, 7, 14, 19, 49, 0, time.UTC)
+	headers := map[string]any{
+		"attempt":  int8(-3),
+		"sent":     stamp,
+		"checksum": []byte{0x00, 0xff},
+		"price":    parser.Decimal{Scale: 2, Value: 1999},
+		"ratio":    float64(2),
+		"count":    uint32(1 << 31),
+		"nested":   map[string]any{"tries": []any{int16(1), "two", nil, true}},
+	}
+
+	var file bytes.Buffer
+	if err := NewWriter(&file).Write(Message{Properties: client.Properties{Headers: headers}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(file.String(), `"attempt":{"type":"int8","value":-3}`) {
+		t.Errorf("expected typed headers in %s", file.String())
+	}
+
+	m, err := NewReader(&file).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m.Properties.Headers, headers) {
+		t.Errorf("expected headers %#v, got %#v", headers, m.Properties.Headers)
+	}
+
+	replayed := table(m.Properties.Headers)
+	expected := amqp.Table{
+		"attempt":  byte(0xfd),
+		"sent":     stamp,
+		"checksum": []byte{0x00, 0xff},
+		"price":    amqp.Decimal{Scale: 2, Value: 1999},
+		"ratio":    float64(2),
+		"count":    int64(1 << 31),
+		"nested":   amqp.Table{"tries": []any{int16(1), "two", nil, true}},
+	}
+	if !reflect.DeepEqual(replayed, expected) {
+		t.Errorf("expected table %#v, got %#v", expected, replayed)
+	}
+	if err := replayed.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUntypedHeaders(t *testing.T) {
+	file := `{"timestamp":"2022-05-07T14:19:49.0Z","properties":{"headers":{"attempt":1,"ratio":0.5,"tenant":"acme","tags":[2]}},"body":""}`
+
+	m, err := NewReader(strings.NewReader(file)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"attempt": int64(1), "ratio": 0.5, "tenant": "acme", "tags": []any{int64(2)}}
+	if !reflect.DeepEqual(m.Properties.Headers, expected) {
+		t.Errorf("expected headers %#v, got %#v", expected, m.Properties.Headers)
+	}
+}
+
+func TestWriterReader(t *testing.T) {
+	stamp := time.Date(2022, 5, 7, 14, 19, 49, 318000000, time.UTC)
+	messages := []Message{
+		{
+			Time:       stamp,
+			VHost:      "/dev",
+			Exchange:   "orders",
+			RoutingKey: "order.created",
+			Properties: client.Properties{ContentType: "application/json", DeliveryMode: 2, Timestamp: &stamp},
+			Body:       []byte(`{"id":1}`),
+		},
+		{Time: stamp.Add(time.Second), VHost: "/", Body: []byte{0x00, 0xff, 0xfe}},
+	}
+
+	var file bytes.Buffer
+	w := NewWriter(&file)
+	for _, m := range messages {
+		if err := w.Write(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lines := strings.Count(file.String(), "\n"); lines != len(messages) {
+		t.Errorf("expected one line per message, got %v lines", lines)
+	}
+	file.WriteString("\n") // empty lines are skipped
+
+	r := NewReader(&file)
+	for _, expected := range messages {
+		m, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m, expected) {
+			t.Errorf("expected %#v, got %#v", expected, m)
+		}
+	}
+	if _, err := r.Read(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF after the last message, got %v", err)
+	}
+
+	r = NewReader(strings.NewReader("{}\n\n{\"body\": 1}\n"))
+	if _, err := r.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Read(); err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("expected an error on line 3, got %v", err)
+	}
+}
+
+func TestTiming(t *testing.T) {
+	start := time.Date(2022, 5, 7, 14, 19, 49, 0, time.UTC)
+	at := func(offset time.Duration) Message { return Message{Time: start.Add(offset)} }
+
+	for _, tc := range []struct {
+		name       string
+		timing     Timing
+		prev, next Message
+		expected   time.Duration
+	}{
+		{"original", OriginalTiming, at(0), at(1500 * time.Millisecond), 1500 * time.Millisecond},
+		{"original out of order", OriginalTiming, at(time.Second), at(0), 0},
+		{"fixed rate", FixedRate(4), at(0), at(time.Hour), 250 * time.Millisecond},
+		{"fixed rate ignores times", FixedRate(4), at(time.Hour), at(0), 250 * time.Millisecond},
+		{"as fast as possible", AsFastAsPossible, at(0), at(time.Hour), 0},
+	} {
+		if delay := tc.timing(tc.prev, tc.next); delay != tc.expected {
+			t.Errorf("%v: expected %v, got %v", tc.name, tc.expected, delay)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var file bytes.Buffer
+	w := NewWriter(&file)
+	start := time.Now()
+	for i, offset := range []time.Duration{0, 50 * time.Millisecond, 20 * time.Millisecond} {
+		w.Write(Message{Time: start.Add(offset), RoutingKey: fmt.Sprint(i)})
+	}
+	recorded := file.String()
+
+	// the first message is published right away, then the delays are 50ms and 0
+	var published []string
+	before := time.Now()
+	count, err := Replay(NewReader(strings.NewReader(recorded)), OriginalTiming, func(m Message) error {
+		published = append(published, m.RoutingKey)
+		return nil
+	})
+	if err != nil || count != 3 || !reflect.DeepEqual(published, []string{"0", "1", "2"}) {
+		t.Fatalf("expected 3 messages in order, got %v (%v): %v", count, published, err)
+	}
+	if elapsed := time.Since(before); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected the recorded delays to take about 50ms, took %v", elapsed)
+	}
+
+	before = time.Now()
+	count, _ = Replay(NewReader(strings.NewReader(recorded)), FixedRate(20), func(Message) error { return nil })
+	if elapsed := time.Since(before); count != 3 || elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected 3 messages in about 100ms at 20 per second, got %v in %v", count, elapsed)
+	}
+
+	failed := errors.New("connection lost")
+	count, err = Replay(NewReader(strings.NewReader(recorded)), AsFastAsPossible, func(m Message) error {
+		if m.RoutingKey == "1" {
+			return failed
+		}
+		return nil
+	})
+	if count != 1 || !errors.Is(err, failed) {
+		t.Errorf("expected to stop after 1 message with %v, got %v: %v", failed, count, err)
+	}
+}
+
+func TestExportPcapng(t *testing.T) {
+	stamp := time.Date(2022, 5, 7, 14, 19, 49, 0, time.UTC)
+	large := make([]byte, maxSegment+10)
+	frames := []Frame{
+		{Time: stamp, Connection: 1, Client: "127.0.0.1:56887", Server: "127.0.0.1:8080", Direction: Inbound, Data: parser.Hello},
+		{Time: stamp, Connection: 1, Client: "127.0.0.1:56887", Server: "127.0.0.1:8080", Direction: Outbound, Data: large},
+		{Time: stamp, Connection: 2, Client: "[::1]:56888", Server: "[::1]:8080", Direction: Inbound, Data: parser.Hello},
+	}
+	var file bytes.Buffer
+	fw := NewFrameWriter(&file)
+	for _, f := range frames {
+		fw.Write(f)
+	}
+
+	var out bytes.Buffer
+	count, err := ExportPcapng(NewFrameReader(&file), &out, 5672)
+	if err != nil || count != len(frames) {
+		t.Fatalf("expected %v exported frames, got %v: %v", len(frames), count, err)
+	}
+
+	// every block starts with its type and length and ends with the length again
+	var blocks [][]byte
+	var types []uint32
+	for data := out.Bytes(); len(data) > 0; {
+		if len(data) < 12 {
+			t.Fatalf("truncated block: %x", data)
+		}
+		total := binary.LittleEndian.Uint32(data[4:])
+		if total%4 != 0 || int(total) > len(data) || binary.LittleEndian.Uint32(data[total-4:]) != total {
+			t.Fatalf("invalid block length %v", total)
+		}
+		types = append(types, binary.LittleEndian.Uint32(data))
+		blocks = append(blocks, data[8:total-4])
+		data = data[total:]
+	}
+
+	// section, interface and per connection a handshake of 3 segments before the data segments:
+	// the large frame is split in two, so there are 3 data segments on the first connection and 1 on the second
+	expected := []uint32{blockSection, blockInterface}
+	for i := 0; i < 3+3+3+1; i++ {
+		expected = append(expected, blockPacket)
+	}
+	if !reflect.DeepEqual(types, expected) {
+		t.Fatalf("expected blocks %x, got %x", expected, types)
+	}
+	if magic := binary.LittleEndian.Uint32(blocks[0]); magic != byteOrderMagic {
+		t.Errorf("expected the byte-order magic, got %x", magic)
+	}
+	if link := binary.LittleEndian.Uint16(blocks[1]); link != linkTypeRaw {
+		t.Errorf("expected link type %v, got %v", linkTypeRaw, link)
+	}
+
+	type segment struct {
+		srcPort, dstPort uint16
+		seq, ack         uint32
+		flags            uint8
+		payload          int
+	}
+	var segments []segment
+	for _, block := range blocks[2:] {
+		if micros := uint64(binary.LittleEndian.Uint32(block[4:]))<<32 | uint64(binary.LittleEndian.Uint32(block[8:])); micros != uint64(stamp.UnixMicro()) {
+			t.Errorf("expected timestamp %v, got %v", stamp.UnixMicro(), micros)
+		}
+		packet := block[20 : 20+binary.LittleEndian.Uint32(block[12:])]
+
+		var tcp []byte
+		switch packet[0] >> 4 {
+		case 4:
+			if sum := checksum(packet[:20]); sum != 0 {
+				t.Errorf("invalid IPv4 header checksum, sums up to %x", sum)
+			}
+			if size := binary.BigEndian.Uint16(packet[2:]); int(size) != len(packet) {
+				t.Errorf("expected IPv4 total length %v, got %v", len(packet), size)
+			}
+			tcp = packet[20:]
+		case 6:
+			if size := binary.BigEndian.Uint16(packet[4:]); int(size) != len(packet)-40 {
+				t.Errorf("expected IPv6 payload length %v, got %v", len(packet)-40, size)
+			}
+			tcp = packet[40:]
+		default:
+			t.Fatalf("unexpected IP version in %x", packet[0])
+		}
+
+		segments = append(segments, segment{
+			srcPort: binary.BigEndian.Uint16(tcp[0:]),
+			dstPort: binary.BigEndian.Uint16(tcp[2:]),
+			seq:     binary.BigEndian.Uint32(tcp[4:]),
+			ack:     binary.BigEndian.Uint32(tcp[8:]),
+			flags:   tcp[13],
+			payload: len(tcp) - 20,
+		})
+	}
+
+	const data = tcpPSH | tcpACK
+	expectedSegments := []segment{
+		{56887, 5672, 1000, 0, tcpSYN, 0},
+		{5672, 56887, 5000, 1001, tcpSYN | tcpACK, 0},
+		{56887, 5672, 1001, 5001, tcpACK, 0},
+		{56887, 5672, 1001, 5001, data, len(parser.Hello)},
+		{5672, 56887, 5001, 1009, data, maxSegment},
+		{5672, 56887, 5001 + maxSegment, 1009, data, 10},
+		{56888, 5672, 1000, 0, tcpSYN, 0},
+		{5672, 56888, 5000, 1001, tcpSYN | tcpACK, 0},
+		{56888, 5672, 1001, 5001, tcpACK, 0},
+		{56888, 5672, 1001, 5001, data, len(parser.Hello)},
+	}
+	if !reflect.DeepEqual(segments, expectedSegments) {
+		t.Errorf("expected segments\n%v\ngot\n%v", expectedSegments, segments)
+	}
+}
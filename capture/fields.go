@@ -0,0 +1,295 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	parser "github.com/resamvi/amqparrot/amqp"
+)
+
+// Field types of header values in capture files. JSON alone cannot tell an int8 from a double
+// or a byte array from a string, so every header value is stored as {"type": ..., "value": ...}.
+const (
+	fieldBool      = "bool"
+	fieldInt8      = "int8"
+	fieldUint8     = "uint8"
+	fieldInt16     = "int16"
+	fieldUint16    = "uint16"
+	fieldInt32     = "int32"
+	fieldUint32    = "uint32"
+	fieldInt64     = "int64"
+	fieldFloat32   = "float32"
+	fieldFloat64   = "float64"
+	fieldDecimal   = "decimal"
+	fieldString    = "string"
+	fieldBytes     = "bytes"
+	fieldTimestamp = "timestamp"
+	fieldTable     = "table"
+	fieldArray     = "array"
+	fieldVoid      = "void"
+)
+
+// typedField is a header value along with its field type
+type typedField struct {
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
+// decimal is parser.Decimal in JSON
+type decimal struct {
+	Scale uint8 `json:"scale"`
+	Value int32 `json:"value"`
+}
+
+// MarshalJSON stores the headers along with their field types
+func (m Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	typed := message(m)
+	if m.Properties.Headers != nil {
+		typed.Properties.Headers = typeTable(m.Properties.Headers)
+	}
+
+	return json.Marshal(typed)
+}
+
+// UnmarshalJSON restores the headers with the Go types the server decoded them to, see typeField.
+// In files recorded without field types, whole numbers become int64 and all other numbers float64.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type message Message
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode((*message)(m)); err != nil {
+		return err
+	}
+	if m.Properties.Headers == nil {
+		return nil
+	}
+
+	headers, err := untypeTable(m.Properties.Headers)
+	if err != nil {
+		return fmt.Errorf("headers: %w", err)
+	}
+	m.Properties.Headers = headers
+
+	return nil
+}
+
+func typeTable(table map[string]any) map[string]any {
+	typed := make(map[string]any, len(table))
+	for name, value := range table {
+		typed[name] = typeField(value)
+	}
+
+	return typed
+}
+
+// typeField tags `value` with the field type of the Go type parser.readField decodes it to
+func typeField(value any) typedField {
+	switch v := value.(type) {
+	case bool:
+		return typedField{fieldBool, v}
+	case int8:
+		return typedField{fieldInt8, v}
+	case uint8:
+		return typedField{fieldUint8, v}
+	case int16:
+		return typedField{fieldInt16, v}
+	case uint16:
+		return typedField{fieldUint16, v}
+	case int32:
+		return typedField{fieldInt32, v}
+	case uint32:
+		return typedField{fieldUint32, v}
+	case int64:
+		return typedField{fieldInt64, v}
+	case float32:
+		return typedField{fieldFloat32, v}
+	case float64:
+		return typedField{fieldFloat64, v}
+	case parser.Decimal:
+		return typedField{fieldDecimal, decimal{v.Scale, v.Value}}
+	case string:
+		return typedField{fieldString, v}
+	case []byte:
+		return typedField{fieldBytes, v}
+	case time.Time:
+		return typedField{fieldTimestamp, v}
+	case map[string]any:
+		return typedField{fieldTable, typeTable(v)}
+	case []any:
+		array := make([]typedField, len(v))
+		for i, item := range v {
+			array[i] = typeField(item)
+		}
+		return typedField{fieldArray, array}
+	case nil:
+		return typedField{fieldVoid, nil}
+	}
+
+	// not decoded by the server; keep what JSON makes of it
+	return typedField{fieldString, fmt.Sprint(value)}
+}
+
+func untypeTable(table map[string]any) (map[string]any, error) {
+	untyped := make(map[string]any, len(table))
+	for name, value := range table {
+		v, err := untypeField(value)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", name, err)
+		}
+		untyped[name] = v
+	}
+
+	return untyped, nil
+}
+
+// untypeField turns a value decoded with json.Number back into the Go type of its field type
+func untypeField(value any) (any, error) {
+	typed, ok := asTypedField(value)
+	if !ok {
+		return untypeLegacy(value), nil
+	}
+
+	switch typed.Type {
+	case fieldBool:
+		v, ok := typed.Value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("invalid bool %v", typed.Value)
+		}
+		return v, nil
+	case fieldInt8, fieldUint8, fieldInt16, fieldUint16, fieldInt32, fieldUint32, fieldInt64:
+		return untypeInteger(typed)
+	case fieldFloat32, fieldFloat64:
+		n, ok := typed.Value.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("invalid %v %v", typed.Type, typed.Value)
+		}
+		f, err := n.Float64()
+		if typed.Type == fieldFloat32 {
+			return float32(f), err
+		}
+		return f, err
+	case fieldDecimal:
+		fields, _ := typed.Value.(map[string]any)
+		scale, err1 := untypeInteger(typedField{fieldUint8, fields["scale"]})
+		value, err2 := untypeInteger(typedField{fieldInt32, fields["value"]})
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("invalid decimal %v", typed.Value)
+		}
+		return parser.Decimal{Scale: scale.(uint8), Value: value.(int32)}, nil
+	case fieldString:
+		v, ok := typed.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid string %v", typed.Value)
+		}
+		return v, nil
+	case fieldBytes:
+		v, _ := typed.Value.(string)
+		return base64.StdEncoding.DecodeString(v)
+	case fieldTimestamp:
+		v, _ := typed.Value.(string)
+		return time.Parse(time.RFC3339Nano, v)
+	case fieldTable:
+		v, ok := typed.Value.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid table %v", typed.Value)
+		}
+		return untypeTable(v)
+	case fieldArray:
+		items, ok := typed.Value.([]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid array %v", typed.Value)
+		}
+		array := make([]any, len(items))
+		for i, item := range items {
+			v, err := untypeField(item)
+			if err != nil {
+				return nil, err
+			}
+			array[i] = v
+		}
+		return array, nil
+	}
+
+	return nil, nil // void
+}
+
+// asTypedField reports whether `value` is a typed field as written by typeField
+func asTypedField(value any) (typedField, bool) {
+	object, ok := value.(map[string]any)
+	if !ok || len(object) != 2 {
+		return typedField{}, false
+	}
+	typ, ok := object["type"].(string)
+	if _, hasValue := object["value"]; !ok || !hasValue {
+		return typedField{}, false
+	}
+	switch typ {
+	case fieldBool, fieldInt8, fieldUint8, fieldInt16, fieldUint16, fieldInt32, fieldUint32, fieldInt64,
+		fieldFloat32, fieldFloat64, fieldDecimal, fieldString, fieldBytes, fieldTimestamp, fieldTable, fieldArray, fieldVoid:
+		return typedField{typ, object["value"]}, true
+	}
+
+	return typedField{}, false
+}
+
+// untypeInteger converts an integer field to its Go type, failing if it does not fit
+func untypeInteger(typed typedField) (any, error) {
+	n, ok := typed.Value.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("invalid %v %v", typed.Type, typed.Value)
+	}
+	i, err := n.Int64()
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v %v", typed.Type, typed.Value)
+	}
+
+	inRange := func(min, max int64) bool { return i >= min && i <= max }
+	switch {
+	case typed.Type == fieldInt8 && inRange(-1<<7, 1<<7-1):
+		return int8(i), nil
+	case typed.Type == fieldUint8 && inRange(0, 1<<8-1):
+		return uint8(i), nil
+	case typed.Type == fieldInt16 && inRange(-1<<15, 1<<15-1):
+		return int16(i), nil
+	case typed.Type == fieldUint16 && inRange(0, 1<<16-1):
+		return uint16(i), nil
+	case typed.Type == fieldInt32 && inRange(-1<<31, 1<<31-1):
+		return int32(i), nil
+	case typed.Type == fieldUint32 && inRange(0, 1<<32-1):
+		return uint32(i), nil
+	case typed.Type == fieldInt64:
+		return i, nil
+	}
+
+	return nil, fmt.Errorf("%v out of range for %v", i, typed.Type)
+}
+
+// untypeLegacy guesses the type of values in files recorded without field types
+func untypeLegacy(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		table := make(map[string]any, len(v))
+		for name, item := range v {
+			table[name] = untypeLegacy(item)
+		}
+		return table
+	case []any:
+		array := make([]any, len(v))
+		for i, item := range v {
+			array[i] = untypeLegacy(item)
+		}
+		return array
+	}
+
+	return value
+}
@@ -0,0 +1,80 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Directions of a Frame
+const (
+	Inbound  = "in"
+	Outbound = "out"
+)
+
+// Frame is a frame read from or written to a client, stored in one line of a frame file.
+// The protocol header a client starts with is stored as frame as well.
+type Frame struct {
+	Time       time.Time `json:"timestamp"`
+	Connection uint64    `json:"connection"`
+	// Client and Server are the addresses of both ends of the connection
+	Client    string `json:"client"`
+	Server    string `json:"server"`
+	Direction string `json:"direction"`
+	// Data is the complete frame including its frame-end octet, base64 encoded in the file
+	Data []byte `json:"data"`
+}
+
+// FrameWriter appends frames to a frame file
+type FrameWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewFrameWriter(w io.Writer) *FrameWriter {
+	return &FrameWriter{enc: json.NewEncoder(w)}
+}
+
+// Write appends `f` as a single line; it is safe to call from several connections
+func (w *FrameWriter) Write(f Frame) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.enc.Encode(f)
+}
+
+// FrameReader reads frames from a frame file
+type FrameReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func NewFrameReader(r io.Reader) *FrameReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLine)
+
+	return &FrameReader{scanner: scanner}
+}
+
+// Read returns the next frame and io.EOF after the last one. Empty lines are skipped.
+func (r *FrameReader) Read() (Frame, error) {
+	var f Frame
+	for r.scanner.Scan() {
+		r.line++
+		if len(r.scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(r.scanner.Bytes(), &f); err != nil {
+			return f, fmt.Errorf("line %v: %w", r.line, err)
+		}
+		return f, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return f, err
+	}
+
+	return f, io.EOF
+}
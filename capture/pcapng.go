@@ -0,0 +1,249 @@
+package capture
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// pcapng block types and the link type of packets starting with their IP header
+const (
+	blockSection   = 0x0A0D0D0A
+	blockInterface = 0x00000001
+	blockPacket    = 0x00000006
+	byteOrderMagic = 0x1A2B3C4D
+	linkTypeRaw    = 101
+)
+
+// maxSegment is the most payload put into one synthetic TCP segment
+const maxSegment = 65000
+
+// TCP flags
+const (
+	tcpSYN = 0x02
+	tcpPSH = 0x08
+	tcpACK = 0x10
+)
+
+// ExportPcapng converts all frames from `r` into a pcapng file Wireshark can dissect as AMQP.
+// Every connection becomes a TCP stream with synthetic IP and TCP headers starting with a handshake.
+// The server side uses `serverPort` instead of the recorded port, 5672 lets Wireshark pick the
+// AMQP dissector without "Decode As". A serverPort of 0 keeps the recorded port.
+// It returns the number of exported frames.
+func ExportPcapng(r *FrameReader, w io.Writer, serverPort int) (int, error) {
+	p := &pcapng{w: w, streams: make(map[uint64]*stream), serverPort: serverPort}
+	if err := p.header(); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for {
+		f, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+
+		if err := p.frame(f); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
+
+type pcapng struct {
+	w          io.Writer
+	streams    map[uint64]*stream
+	serverPort int
+}
+
+// stream is the synthetic TCP connection of a client connection
+type stream struct {
+	client, server       endpoint
+	clientSeq, serverSeq uint32
+}
+
+type endpoint struct {
+	ip   net.IP
+	port uint16
+}
+
+func (p *pcapng) header() error {
+	section := make([]byte, 16)
+	binary.LittleEndian.PutUint32(section[0:], byteOrderMagic)
+	binary.LittleEndian.PutUint16(section[4:], 1) // major version
+	binary.LittleEndian.PutUint16(section[6:], 0) // minor version
+	binary.LittleEndian.PutUint64(section[8:], ^uint64(0))
+	if err := p.block(blockSection, section); err != nil {
+		return err
+	}
+
+	iface := make([]byte, 8)
+	binary.LittleEndian.PutUint16(iface[0:], linkTypeRaw)
+	binary.LittleEndian.PutUint32(iface[4:], 0) // no snap length
+
+	return p.block(blockInterface, iface)
+}
+
+// block writes a pcapng block with `body` padded to 32 bits
+func (p *pcapng) block(typ uint32, body []byte) error {
+	padded := (len(body) + 3) &^ 3
+	total := uint32(12 + padded)
+
+	buf := make([]byte, total)
+	binary.LittleEndian.PutUint32(buf[0:], typ)
+	binary.LittleEndian.PutUint32(buf[4:], total)
+	copy(buf[8:], body)
+	binary.LittleEndian.PutUint32(buf[total-4:], total)
+
+	_, err := p.w.Write(buf)
+	return err
+}
+
+func (p *pcapng) frame(f Frame) error {
+	s, ok := p.streams[f.Connection]
+	if !ok {
+		var err error
+		if s, err = p.open(f); err != nil {
+			return err
+		}
+	}
+
+	data := f.Data
+	for len(data) > 0 {
+		size := len(data)
+		if size > maxSegment {
+			size = maxSegment
+		}
+		if err := p.segment(f, s, f.Direction == Outbound, tcpPSH|tcpACK, data[:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+
+	return nil
+}
+
+// open starts the stream of a connection with a TCP handshake
+func (p *pcapng) open(f Frame) (*stream, error) {
+	client, err := parseEndpoint(f.Client)
+	if err != nil {
+		return nil, fmt.Errorf("connection %v: client address: %w", f.Connection, err)
+	}
+	server, err := parseEndpoint(f.Server)
+	if err != nil {
+		return nil, fmt.Errorf("connection %v: server address: %w", f.Connection, err)
+	}
+	if p.serverPort != 0 {
+		server.port = uint16(p.serverPort)
+	}
+
+	s := &stream{client: client, server: server, clientSeq: 1000, serverSeq: 5000}
+	p.streams[f.Connection] = s
+
+	if err := p.segment(f, s, false, tcpSYN, nil); err != nil {
+		return nil, err
+	}
+	s.clientSeq++
+	if err := p.segment(f, s, true, tcpSYN|tcpACK, nil); err != nil {
+		return nil, err
+	}
+	s.serverSeq++
+
+	return s, p.segment(f, s, false, tcpACK, nil)
+}
+
+// segment writes one TCP segment sent by the server if `fromServer` and advances its sequence number
+func (p *pcapng) segment(f Frame, s *stream, fromServer bool, flags uint8, payload []byte) error {
+	src, dst, seq, ack := s.client, s.server, &s.clientSeq, s.serverSeq
+	if fromServer {
+		src, dst, seq, ack = s.server, s.client, &s.serverSeq, s.clientSeq
+	}
+	if flags&tcpSYN != 0 && flags&tcpACK == 0 {
+		ack = 0
+	}
+
+	tcp := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(tcp[0:], src.port)
+	binary.BigEndian.PutUint16(tcp[2:], dst.port)
+	binary.BigEndian.PutUint32(tcp[4:], *seq)
+	binary.BigEndian.PutUint32(tcp[8:], ack)
+	tcp[12] = 5 << 4 // header length in 32 bit words
+	tcp[13] = flags
+	binary.BigEndian.PutUint16(tcp[14:], 65535) // window
+	tcp = append(tcp, payload...)
+	*seq += uint32(len(payload))
+
+	packet := ipPacket(src.ip, dst.ip, tcp)
+
+	micros := uint64(f.Time.UnixNano() / 1000)
+	body := make([]byte, 20, 20+len(packet))
+	binary.LittleEndian.PutUint32(body[0:], 0) // interface
+	binary.LittleEndian.PutUint32(body[4:], uint32(micros>>32))
+	binary.LittleEndian.PutUint32(body[8:], uint32(micros))
+	binary.LittleEndian.PutUint32(body[12:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(body[16:], uint32(len(packet)))
+	body = append(body, packet...)
+
+	return p.block(blockPacket, body)
+}
+
+// ipPacket wraps the TCP segment in an IPv4 or IPv6 header; the TCP checksum is left empty
+func ipPacket(src, dst net.IP, tcp []byte) []byte {
+	if src4, dst4 := src.To4(), dst.To4(); src4 != nil && dst4 != nil {
+		header := make([]byte, 20, 20+len(tcp))
+		header[0] = 4<<4 | 5 // version and header length
+		binary.BigEndian.PutUint16(header[2:], uint16(20+len(tcp)))
+		header[8] = 64 // TTL
+		header[9] = 6  // TCP
+		copy(header[12:], src4)
+		copy(header[16:], dst4)
+		binary.BigEndian.PutUint16(header[10:], checksum(header))
+
+		return append(header, tcp...)
+	}
+
+	header := make([]byte, 40, 40+len(tcp))
+	header[0] = 6 << 4
+	binary.BigEndian.PutUint16(header[4:], uint16(len(tcp)))
+	header[6] = 6 // TCP
+	header[7] = 64
+	copy(header[8:], src.To16())
+	copy(header[24:], dst.To16())
+
+	return append(header, tcp...)
+}
+
+func checksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i < len(header); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(header[i:]))
+	}
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+
+	return ^uint16(sum)
+}
+
+func parseEndpoint(addr string) (endpoint, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return endpoint{}, err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return endpoint{}, fmt.Errorf("%q is no IP address", host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return endpoint{}, err
+	}
+
+	return endpoint{ip: ip, port: uint16(p)}, nil
+}
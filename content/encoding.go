@@ -0,0 +1,67 @@
+package content
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MaxDecodedSize limits how large a decoded body may grow to guard against compression bombs
+const MaxDecodedSize = 64 << 20
+
+var (
+	// ErrUnsupportedEncoding is returned for content encodings that are no compression known to Decode
+	ErrUnsupportedEncoding = errors.New("unsupported content-encoding")
+	// ErrTooLarge is returned for bodies decoding to more than MaxDecodedSize bytes
+	ErrTooLarge = fmt.Errorf("decoded body exceeds %v bytes", MaxDecodedSize)
+)
+
+// Decode decompresses `body` according to `encoding`, the content-encoding property.
+// Supported are gzip and deflate, which is accepted with and without zlib wrapper.
+// Several encodings separated by commas are undone in reverse order like in HTTP.
+func Decode(body []byte, encoding string) ([]byte, error) {
+	encodings := strings.Split(encoding, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var err error
+		if body, err = decode(body, strings.ToLower(strings.TrimSpace(encodings[i]))); err != nil {
+			return nil, err
+		}
+	}
+
+	return body, nil
+}
+
+func decode(body []byte, encoding string) ([]byte, error) {
+	var (
+		r   io.Reader
+		err error
+	)
+	switch encoding {
+	case "gzip", "x-gzip":
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate", "zlib":
+		if r, err = zlib.NewReader(bytes.NewReader(body)); err != nil {
+			r, err = flate.NewReader(bytes.NewReader(body)), nil // raw deflate as sent by some publishers
+		}
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedEncoding, encoding)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not decode %v: %w", encoding, err)
+	}
+
+	decoded, err := io.ReadAll(io.LimitReader(r, MaxDecodedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("could not decode %v: %w", encoding, err)
+	}
+	if len(decoded) > MaxDecodedSize {
+		return nil, ErrTooLarge
+	}
+
+	return decoded, nil
+}
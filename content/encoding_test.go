@@ -0,0 +1,60 @@
+package content
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	compress := func(w io.WriteCloser, buf *bytes.Buffer) []byte {
+		w.Write(body)
+		w.Close()
+		return buf.Bytes()
+	}
+
+	var gz, zl, fl bytes.Buffer
+	gzipped := compress(gzip.NewWriter(&gz), &gz)
+	zlibbed := compress(zlib.NewWriter(&zl), &zl)
+	flater, _ := flate.NewWriter(&fl, flate.DefaultCompression)
+	flated := compress(flater, &fl)
+
+	var twice bytes.Buffer
+	gzipThenDeflate := compress(zlib.NewWriter(&twice), &twice)
+	twice = bytes.Buffer{}
+	w := gzip.NewWriter(&twice)
+	w.Write(gzipThenDeflate)
+	w.Close()
+
+	for _, tc := range []struct {
+		name, encoding string
+		body           []byte
+	}{
+		{"gzip", "gzip", gzipped},
+		{"deflate", "deflate", zlibbed},
+		{"raw deflate", "Deflate", flated},
+		{"several", "deflate, gzip", twice.Bytes()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			decoded, err := Decode(tc.body, tc.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decoded, body) {
+				t.Errorf("expected %q, got %q", body, decoded)
+			}
+		})
+	}
+
+	if _, err := Decode(body, "utf-8"); !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("expected ErrUnsupportedEncoding, got %v", err)
+	}
+	if _, err := Decode(body, "gzip"); err == nil || errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("expected gzip error, got %v", err)
+	}
+}
@@ -0,0 +1,904 @@
+package content
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/resamvi/amqparrot/amqp"
+)
+
+// ProtoMapping selects the protobuf message bodies are decoded as.
+// A mapping applies if all of its non-empty conditions match.
+type ProtoMapping struct {
+	Exchange string `json:"exchange"`
+	// RoutingKey is a topic pattern like `order.*`
+	RoutingKey string `json:"routing_key"`
+	// Type is compared to the type property of the message
+	Type string `json:"type"`
+
+	// Message is the fully qualified name of the message, e.g. `shop.OrderCreated`
+	Message string `json:"message"`
+}
+
+// Protobuf decodes protobuf bodies to JSON using the messages of a FileDescriptorSet
+type Protobuf struct {
+	messages map[string]*protoMessage
+	enums    map[string]map[int32]string
+	mappings []ProtoMapping
+}
+
+// maxProtoDepth limits the nesting of decoded messages
+const maxProtoDepth = 100
+
+var errProtoTruncated = errors.New("truncated protobuf")
+
+// LoadProtobuf reads a binary FileDescriptorSet as written by `protoc --descriptor_set_out`
+// and a JSON file with a list of mappings like
+//
+//	[{"exchange": "orders", "routing_key": "order.created", "message": "shop.OrderCreated"}]
+//
+// The mapping file is optional; without it bodies are decoded as the message named by their type property.
+func LoadProtobuf(descriptorFile, mappingFile string) (*Protobuf, error) {
+	set, err := os.ReadFile(descriptorFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read descriptor set: %w", err)
+	}
+
+	var mappings []ProtoMapping
+	if mappingFile != "" {
+		data, err := os.ReadFile(mappingFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read protobuf mapping: %w", err)
+		}
+		if err := json.Unmarshal(data, &mappings); err != nil {
+			return nil, fmt.Errorf("could not parse protobuf mapping: %w", err)
+		}
+	}
+
+	return NewProtobuf(set, mappings)
+}
+
+// NewProtobuf parses the binary FileDescriptorSet `set` and checks that all mapped messages exist
+func NewProtobuf(set []byte, mappings []ProtoMapping) (*Protobuf, error) {
+	p := &Protobuf{
+		messages: make(map[string]*protoMessage),
+		enums:    make(map[string]map[int32]string),
+		mappings: mappings,
+	}
+
+	err := protoFields(set, func(num int, _ int, _ uint64, file []byte) error {
+		if num != 1 { // FileDescriptorSet.file
+			return nil
+		}
+		return p.addFile(file)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not parse descriptor set: %w", err)
+	}
+
+	for _, m := range mappings {
+		if _, ok := p.messages[m.Message]; !ok {
+			return nil, fmt.Errorf("mapped message %q is not in the descriptor set", m.Message)
+		}
+	}
+
+	return p, nil
+}
+
+// MessageFor returns the name of the message a body published with the given properties is decoded as.
+// Mappings are tried in order, then the type property is tried as message name.
+func (p *Protobuf) MessageFor(exchange, routingKey, typ string) (string, bool) {
+	for _, m := range p.mappings {
+		if (m.Exchange == "" || m.Exchange == exchange) &&
+			(m.RoutingKey == "" || amqp.MatchTopic(m.RoutingKey, routingKey)) &&
+			(m.Type == "" || m.Type == typ) {
+			return m.Message, true
+		}
+	}
+
+	if _, ok := p.messages[typ]; ok {
+		return typ, true
+	}
+
+	return "", false
+}
+
+// Decode converts `body` to JSON following the protobuf JSON mapping.
+// The name of the message is added as `@type` like in an Any, unknown fields are left out.
+// Well-known types such as Timestamp, Duration, the wrappers, Struct and Any are written in their
+// JSON form as long as the descriptor set includes them. An Any holding a message missing from
+// the descriptor set keeps its value base64 encoded.
+func (p *Protobuf) Decode(message string, body []byte) ([]byte, error) {
+	decoded, err := p.decodeEmbedded(message, body, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(withType(message, message, decoded))
+}
+
+// Descriptors, reduced to what decoding needs
+
+type protoMessage struct {
+	fields   []*protoField
+	byNumber map[int]*protoField
+	mapEntry bool
+}
+
+type protoField struct {
+	name     string
+	number   int
+	repeated bool
+	typ      int
+	typeName string
+}
+
+// Field types of FieldDescriptorProto
+const (
+	protoDouble   = 1
+	protoFloat    = 2
+	protoInt64    = 3
+	protoUint64   = 4
+	protoInt32    = 5
+	protoFixed64  = 6
+	protoFixed32  = 7
+	protoBool     = 8
+	protoString   = 9
+	protoGroup    = 10
+	protoMessageT = 11
+	protoBytes    = 12
+	protoUint32   = 13
+	protoEnum     = 14
+	protoSfixed32 = 15
+	protoSfixed64 = 16
+	protoSint32   = 17
+	protoSint64   = 18
+)
+
+// Wire types
+const (
+	wireVarint     = 0
+	wireFixed64    = 1
+	wireBytes      = 2
+	wireStartGroup = 3
+	wireEndGroup   = 4
+	wireFixed32    = 5
+)
+
+// addFile registers the messages and enums of a FileDescriptorProto
+func (p *Protobuf) addFile(file []byte) error {
+	var pkg string
+	var messages, enums [][]byte
+
+	err := protoFields(file, func(num int, _ int, _ uint64, b []byte) error {
+		switch num {
+		case 2: // package
+			pkg = string(b)
+		case 4: // message_type
+			messages = append(messages, b)
+		case 5: // enum_type
+			enums = append(enums, b)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, m := range messages {
+		if err := p.addMessage(pkg, m); err != nil {
+			return err
+		}
+	}
+	for _, e := range enums {
+		if err := p.addEnum(pkg, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addMessage registers a DescriptorProto declared in `scope` along with its nested types
+func (p *Protobuf) addMessage(scope string, desc []byte) error {
+	msg := &protoMessage{byNumber: make(map[int]*protoField)}
+	var name string
+	var nested, enums [][]byte
+
+	err := protoFields(desc, func(num int, _ int, _ uint64, b []byte) error {
+		switch num {
+		case 1: // name
+			name = string(b)
+		case 2: // field
+			f, err := parseField(b)
+			if err != nil {
+				return err
+			}
+			msg.fields = append(msg.fields, f)
+			msg.byNumber[f.number] = f
+		case 3: // nested_type
+			nested = append(nested, b)
+		case 4: // enum_type
+			enums = append(enums, b)
+		case 7: // options
+			return protoFields(b, func(num int, _ int, v uint64, _ []byte) error {
+				if num == 7 { // MessageOptions.map_entry
+					msg.mapEntry = v != 0
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fullName := qualify(scope, name)
+	p.messages[fullName] = msg
+	for _, n := range nested {
+		if err := p.addMessage(fullName, n); err != nil {
+			return err
+		}
+	}
+	for _, e := range enums {
+		if err := p.addEnum(fullName, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseField decodes a FieldDescriptorProto
+func parseField(desc []byte) (*protoField, error) {
+	f := &protoField{}
+	var jsonName string
+
+	err := protoFields(desc, func(num int, _ int, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			f.name = string(b)
+		case 3:
+			f.number = int(v)
+		case 4:
+			f.repeated = v == 3 // LABEL_REPEATED
+		case 5:
+			f.typ = int(v)
+		case 6:
+			f.typeName = strings.TrimPrefix(string(b), ".")
+		case 10:
+			jsonName = string(b)
+		}
+		return nil
+	})
+	if jsonName == "" { // protoc always sets json_name, other tools may not
+		jsonName = lowerCamel(f.name)
+	}
+	f.name = jsonName
+
+	return f, err
+}
+
+// lowerCamel converts a field name like `order_id` to its JSON name `orderId`
+func lowerCamel(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range name {
+		switch {
+		case r == '_':
+			upper = true
+		case upper:
+			b.WriteString(strings.ToUpper(string(r)))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// addEnum registers an EnumDescriptorProto declared in `scope`
+func (p *Protobuf) addEnum(scope string, desc []byte) error {
+	var name string
+	values := make(map[int32]string)
+
+	err := protoFields(desc, func(num int, _ int, _ uint64, b []byte) error {
+		switch num {
+		case 1:
+			name = string(b)
+		case 2: // value
+			var valueName string
+			var number int32
+			err := protoFields(b, func(num int, _ int, v uint64, b []byte) error {
+				switch num {
+				case 1:
+					valueName = string(b)
+				case 2:
+					number = int32(v)
+				}
+				return nil
+			})
+			values[number] = valueName
+			return err
+		}
+		return nil
+	})
+
+	p.enums[qualify(scope, name)] = values
+
+	return err
+}
+
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+
+	return scope + "." + name
+}
+
+// Decoding
+
+// member is a JSON object member; object keeps members in the order fields were declared
+type member struct {
+	name  string
+	value any
+}
+
+type object []member
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(m.name)
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+func (p *Protobuf) decodeMessage(msg *protoMessage, data []byte, depth int) (object, error) {
+	values, err := p.decodeValues(msg, data, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := object{}
+	for _, f := range msg.fields {
+		vals, ok := values[f.number]
+		if !ok {
+			continue
+		}
+
+		entry, known := p.messages[f.typeName]
+		switch {
+		case f.typ == protoMessageT && known && entry.mapEntry:
+			entries := object{}
+			for _, v := range vals {
+				kv := v.(map[int][]any)
+				entries = append(entries, member{mapKey(kv[1]), last(kv[2])})
+			}
+			obj = append(obj, member{f.name, entries})
+		case f.repeated:
+			obj = append(obj, member{f.name, vals})
+		default:
+			obj = append(obj, member{f.name, last(vals)})
+		}
+	}
+
+	return obj, nil
+}
+
+// decodeValues collects the decoded values of all known fields in `data` by field number.
+// Map entries are kept as their values by field number.
+func (p *Protobuf) decodeValues(msg *protoMessage, data []byte, depth int) (map[int][]any, error) {
+	if depth > maxProtoDepth {
+		return nil, fmt.Errorf("messages nested deeper than %v", maxProtoDepth)
+	}
+
+	values := make(map[int][]any)
+	// occurrences of a singular message are merged, which is the same as decoding them concatenated
+	merged := make(map[int][]byte)
+	err := protoFields(data, func(num int, wt int, v uint64, b []byte) error {
+		f, ok := msg.byNumber[num]
+		if !ok {
+			return nil
+		}
+
+		if isMessage(f) && !f.repeated {
+			if err := expectWire(wt, messageWire(f)); err != nil {
+				return fmt.Errorf("field %v: %w", f.name, err)
+			}
+			merged[num] = append(merged[num], b...)
+			return nil
+		}
+
+		vals, err := p.decodeField(f, wt, v, b, depth)
+		if err != nil {
+			return fmt.Errorf("field %v: %w", f.name, err)
+		}
+		values[num] = append(values[num], vals...)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for num, b := range merged {
+		f := msg.byNumber[num]
+		value, err := p.decodeEmbedded(f.typeName, b, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("field %v: %w", f.name, err)
+		}
+		values[num] = []any{value}
+	}
+
+	return values, nil
+}
+
+// isMessage reports whether `f` holds an embedded message, either length-delimited or as group
+func isMessage(f *protoField) bool {
+	return f.typ == protoMessageT || f.typ == protoGroup
+}
+
+// messageWire is the wire type of a message field
+func messageWire(f *protoField) int {
+	if f.typ == protoGroup {
+		return wireStartGroup
+	}
+
+	return wireBytes
+}
+
+// decodeEmbedded decodes `data` as the message `name`, well-known types to their JSON form.
+// Map entries are kept as their values by field number.
+func (p *Protobuf) decodeEmbedded(name string, data []byte, depth int) (any, error) {
+	msg, ok := p.messages[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown message %q", name)
+	}
+	if msg.mapEntry {
+		return p.decodeValues(msg, data, depth)
+	}
+	if name == wellKnownAny {
+		return p.decodeAny(data, depth)
+	}
+
+	obj, err := p.decodeMessage(msg, data, depth)
+	if err != nil {
+		return nil, err
+	}
+	if value, ok := wellKnown(name, msg, obj); ok {
+		return value, nil
+	}
+
+	return obj, nil
+}
+
+// decodeField decodes a single occurrence of `f`, which yields several values for packed fields
+func (p *Protobuf) decodeField(f *protoField, wt int, v uint64, b []byte, depth int) ([]any, error) {
+	switch f.typ {
+	case protoString:
+		return []any{string(b)}, expectWire(wt, wireBytes)
+	case protoBytes:
+		return []any{base64.StdEncoding.EncodeToString(b)}, expectWire(wt, wireBytes)
+	case protoMessageT, protoGroup:
+		if err := expectWire(wt, messageWire(f)); err != nil {
+			return nil, err
+		}
+		value, err := p.decodeEmbedded(f.typeName, b, depth+1)
+		return []any{value}, err
+	}
+
+	if wt != wireBytes {
+		value, err := p.scalar(f, wt, v)
+		return []any{value}, err
+	}
+
+	// packed repeated scalars
+	var values []any
+	for len(b) > 0 {
+		var (
+			v  uint64
+			wt int
+		)
+		switch f.typ {
+		case protoDouble, protoFixed64, protoSfixed64:
+			if len(b) < 8 {
+				return nil, errProtoTruncated
+			}
+			v, wt, b = binary.LittleEndian.Uint64(b), wireFixed64, b[8:]
+		case protoFloat, protoFixed32, protoSfixed32:
+			if len(b) < 4 {
+				return nil, errProtoTruncated
+			}
+			v, wt, b = uint64(binary.LittleEndian.Uint32(b)), wireFixed32, b[4:]
+		default:
+			n := 0
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return nil, errProtoTruncated
+			}
+			wt, b = wireVarint, b[n:]
+		}
+
+		value, err := p.scalar(f, wt, v)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// scalar converts a numeric value to its JSON representation; 64 bit integers become strings
+func (p *Protobuf) scalar(f *protoField, wt int, v uint64) (any, error) {
+	switch f.typ {
+	case protoDouble:
+		return float(math.Float64frombits(v)), expectWire(wt, wireFixed64)
+	case protoFloat:
+		return float(float64(math.Float32frombits(uint32(v)))), expectWire(wt, wireFixed32)
+	case protoInt64:
+		return strconv.FormatInt(int64(v), 10), expectWire(wt, wireVarint)
+	case protoUint64:
+		return strconv.FormatUint(v, 10), expectWire(wt, wireVarint)
+	case protoInt32:
+		return int32(v), expectWire(wt, wireVarint)
+	case protoUint32:
+		return uint32(v), expectWire(wt, wireVarint)
+	case protoSint32:
+		return int32(uint32(v)>>1) ^ -int32(v&1), expectWire(wt, wireVarint)
+	case protoSint64:
+		return strconv.FormatInt(int64(v>>1)^-int64(v&1), 10), expectWire(wt, wireVarint)
+	case protoFixed64:
+		return strconv.FormatUint(v, 10), expectWire(wt, wireFixed64)
+	case protoSfixed64:
+		return strconv.FormatInt(int64(v), 10), expectWire(wt, wireFixed64)
+	case protoFixed32:
+		return uint32(v), expectWire(wt, wireFixed32)
+	case protoSfixed32:
+		return int32(v), expectWire(wt, wireFixed32)
+	case protoBool:
+		return v != 0, expectWire(wt, wireVarint)
+	case protoEnum:
+		if name, ok := p.enums[f.typeName][int32(v)]; ok {
+			return name, expectWire(wt, wireVarint)
+		}
+		return int32(v), expectWire(wt, wireVarint)
+	}
+
+	return nil, fmt.Errorf("unknown field type %v", f.typ)
+}
+
+// float keeps values JSON cannot represent as the strings the protobuf JSON mapping uses
+func float(f float64) any {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+
+	return f
+}
+
+func expectWire(got, expected int) error {
+	if got != expected {
+		return fmt.Errorf("wire type %v does not match the declared type", got)
+	}
+
+	return nil
+}
+
+func last(values []any) any {
+	if len(values) == 0 {
+		return nil
+	}
+
+	return values[len(values)-1]
+}
+
+// mapKey is the JSON object key of a map entry key
+func mapKey(values []any) string {
+	if key := last(values); key != nil {
+		return fmt.Sprint(key)
+	}
+
+	return ""
+}
+
+// protoFields calls `fn` for every field in the encoded message `data`.
+// Varint and fixed values are passed as `v`, length-delimited values and the fields of groups as `b`.
+func protoFields(data []byte, fn func(num int, wt int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		num, wt, v, b, rest, err := nextField(data)
+		if err != nil {
+			return err
+		}
+		data = rest
+
+		switch wt {
+		case wireStartGroup:
+			if b, data, err = groupFields(data, num); err != nil {
+				return err
+			}
+		case wireEndGroup:
+			return fmt.Errorf("end of group %v without its start", num)
+		}
+
+		if err := fn(num, wt, v, b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nextField reads the tag and value of the first field in `data`.
+// Groups only consist of their start or end tag.
+func nextField(data []byte) (num, wt int, v uint64, b, rest []byte, err error) {
+	tag, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, 0, 0, nil, nil, errProtoTruncated
+	}
+	num, wt, data = int(tag>>3), int(tag&7), data[n:]
+
+	switch wt {
+	case wireVarint:
+		if v, n = binary.Uvarint(data); n <= 0 {
+			return 0, 0, 0, nil, nil, errProtoTruncated
+		}
+		data = data[n:]
+	case wireFixed64:
+		if len(data) < 8 {
+			return 0, 0, 0, nil, nil, errProtoTruncated
+		}
+		v, data = binary.LittleEndian.Uint64(data), data[8:]
+	case wireFixed32:
+		if len(data) < 4 {
+			return 0, 0, 0, nil, nil, errProtoTruncated
+		}
+		v, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+	case wireBytes:
+		size, n := binary.Uvarint(data)
+		if n <= 0 || size > uint64(len(data)-n) {
+			return 0, 0, 0, nil, nil, errProtoTruncated
+		}
+		b, data = data[n:n+int(size)], data[n+int(size):]
+	case wireStartGroup, wireEndGroup:
+	default:
+		return 0, 0, 0, nil, nil, fmt.Errorf("unsupported wire type %v", wt)
+	}
+
+	return num, wt, v, b, data, nil
+}
+
+// groupFields splits `data` following the start of group `num` into the fields of the group
+// and what follows its end. Nested groups are part of the fields.
+func groupFields(data []byte, num int) (fields, rest []byte, err error) {
+	open := []int{num}
+	for rest = data; ; {
+		if len(rest) == 0 {
+			return nil, nil, errProtoTruncated
+		}
+		fieldNum, wt, _, _, next, err := nextField(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch wt {
+		case wireStartGroup:
+			open = append(open, fieldNum)
+		case wireEndGroup:
+			if fieldNum != open[len(open)-1] {
+				return nil, nil, fmt.Errorf("end of group %v inside group %v", fieldNum, open[len(open)-1])
+			}
+			open = open[:len(open)-1]
+			if len(open) == 0 {
+				return data[:len(data)-len(rest)], next, nil
+			}
+		}
+		rest = next
+	}
+}
+
+// Well-known types with a JSON form of their own
+const (
+	wellKnownAny       = "google.protobuf.Any"
+	wellKnownTimestamp = "google.protobuf.Timestamp"
+	wellKnownDuration  = "google.protobuf.Duration"
+	wellKnownStruct    = "google.protobuf.Struct"
+	wellKnownValue     = "google.protobuf.Value"
+	wellKnownList      = "google.protobuf.ListValue"
+	wellKnownFieldMask = "google.protobuf.FieldMask"
+	wellKnownEmpty     = "google.protobuf.Empty"
+)
+
+// wrappers are the well-known types wrapping a single value
+var wrappers = map[string]bool{
+	"google.protobuf.DoubleValue": true,
+	"google.protobuf.FloatValue":  true,
+	"google.protobuf.Int64Value":  true,
+	"google.protobuf.UInt64Value": true,
+	"google.protobuf.Int32Value":  true,
+	"google.protobuf.UInt32Value": true,
+	"google.protobuf.BoolValue":   true,
+	"google.protobuf.StringValue": true,
+	"google.protobuf.BytesValue":  true,
+}
+
+// wellKnown converts the decoded well-known type `name` to its JSON form.
+// It reports false for all other messages.
+func wellKnown(name string, msg *protoMessage, obj object) (any, bool) {
+	switch {
+	case name == wellKnownTimestamp:
+		seconds, nanos := secondsAndNanos(obj)
+		return time.Unix(seconds, int64(nanos)).UTC().Format("2006-01-02T15:04:05") + fraction(nanos) + "Z", true
+	case name == wellKnownDuration:
+		seconds, nanos := secondsAndNanos(obj)
+		sign := ""
+		if seconds < 0 || nanos < 0 {
+			sign, seconds, nanos = "-", -seconds, -nanos
+		}
+		return sign + strconv.FormatInt(seconds, 10) + fraction(nanos) + "s", true
+	case wrappers[name]:
+		if value, ok := obj.get("value"); ok {
+			return value, true
+		}
+		return zero(msg.byNumber[1]), true
+	case name == wellKnownStruct:
+		if fields, ok := obj.get("fields"); ok {
+			return fields, true
+		}
+		return object{}, true
+	case name == wellKnownValue:
+		// the kind is a oneof, so at most one member is set
+		if len(obj) == 0 || obj[0].name == "nullValue" {
+			return nil, true
+		}
+		return obj[0].value, true
+	case name == wellKnownList:
+		if values, ok := obj.get("values"); ok {
+			return values, true
+		}
+		return []any{}, true
+	case name == wellKnownFieldMask:
+		paths, _ := obj.get("paths")
+		list, _ := paths.([]any)
+		camel := make([]string, len(list))
+		for i, path := range list {
+			camel[i] = lowerCamel(fmt.Sprint(path))
+		}
+		return strings.Join(camel, ","), true
+	case name == wellKnownEmpty:
+		return object{}, true
+	}
+
+	return nil, false
+}
+
+// isWellKnown reports whether the JSON form of message `name` is not an object of its fields
+func isWellKnown(name string) bool {
+	_, ok := wellKnown(name, &protoMessage{}, object{})
+	return ok
+}
+
+// decodeAny decodes the message packed into an Any as an object with its `@type`
+func (p *Protobuf) decodeAny(data []byte, depth int) (any, error) {
+	var typeURL string
+	var value []byte
+	err := protoFields(data, func(num int, _ int, _ uint64, b []byte) error {
+		switch num {
+		case 1: // type_url
+			typeURL = string(b)
+		case 2: // value
+			value = b
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	name := typeURL[strings.LastIndex(typeURL, "/")+1:]
+	if _, ok := p.messages[name]; !ok {
+		return object{{"@type", typeURL}, {"value", base64.StdEncoding.EncodeToString(value)}}, nil
+	}
+	decoded, err := p.decodeEmbedded(name, value, depth+1)
+	if err != nil {
+		return nil, err
+	}
+
+	return withType(typeURL, name, decoded), nil
+}
+
+// withType adds `typ` as `@type` to the decoded message `name`; well-known types become its `value`
+func withType(typ, name string, decoded any) object {
+	if obj, ok := decoded.(object); ok && !isWellKnown(name) {
+		return append(object{{"@type", typ}}, obj...)
+	}
+
+	return object{{"@type", typ}, {"value", decoded}}
+}
+
+// get returns the value of member `name`
+func (o object) get(name string) (any, bool) {
+	for _, m := range o {
+		if m.name == name {
+			return m.value, true
+		}
+	}
+
+	return nil, false
+}
+
+// secondsAndNanos reads the fields of a Timestamp or Duration
+func secondsAndNanos(obj object) (int64, int32) {
+	var seconds int64
+	var nanos int32
+	if v, ok := obj.get("seconds"); ok {
+		seconds, _ = strconv.ParseInt(fmt.Sprint(v), 10, 64)
+	}
+	if v, ok := obj.get("nanos"); ok {
+		nanos, _ = v.(int32)
+	}
+
+	return seconds, nanos
+}
+
+// fraction formats nanoseconds with 3, 6 or 9 digits as the JSON mapping requires
+func fraction(nanos int32) string {
+	if nanos == 0 {
+		return ""
+	}
+
+	digits := fmt.Sprintf("%09d", nanos)
+	for strings.HasSuffix(digits, "000") {
+		digits = digits[:len(digits)-3]
+	}
+
+	return "." + digits
+}
+
+// zero is the JSON value of a field left out because it holds its default value
+func zero(f *protoField) any {
+	if f == nil {
+		return nil
+	}
+
+	switch f.typ {
+	case protoString, protoBytes:
+		return ""
+	case protoBool:
+		return false
+	case protoInt64, protoUint64, protoFixed64, protoSfixed64, protoSint64:
+		return "0"
+	}
+
+	return 0
+}
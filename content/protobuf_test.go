@@ -0,0 +1,192 @@
+package content
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// pb appends protobuf fields for building descriptors and messages in tests
+type pb []byte
+
+func (b pb) varint(num int, v uint64) pb {
+	b = binary.AppendUvarint(b, uint64(num<<3|wireVarint))
+	return binary.AppendUvarint(b, v)
+}
+
+func (b pb) bytes(num int, v []byte) pb {
+	b = binary.AppendUvarint(b, uint64(num<<3|wireBytes))
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func (b pb) str(num int, v string) pb { return b.bytes(num, []byte(v)) }
+
+func (b pb) double(num int, v float64) pb {
+	b = binary.AppendUvarint(b, uint64(num<<3|wireFixed64))
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+}
+
+// group encodes `fields` as group `num`
+func (b pb) group(num int, fields pb) pb {
+	b = binary.AppendUvarint(b, uint64(num<<3|wireStartGroup))
+	b = append(b, fields...)
+	return binary.AppendUvarint(b, uint64(num<<3|wireEndGroup))
+}
+
+func field(name string, number, label, typ int, typeName string) []byte {
+	f := pb{}.str(1, name).varint(3, uint64(number)).varint(4, uint64(label)).varint(5, uint64(typ))
+	if typeName != "" {
+		f = f.str(6, typeName)
+	}
+	return f
+}
+
+func TestProtobuf(t *testing.T) {
+	const optional, repeated = 1, 3
+	countsEntry := pb{}.str(1, "CountsEntry").
+		bytes(2, field("key", 1, optional, protoString, "")).
+		bytes(2, field("value", 2, optional, protoInt32, "")).
+		bytes(7, pb{}.varint(7, 1))
+	order := pb{}.str(1, "Order").
+		bytes(2, field("order_id", 1, optional, protoString, "")).
+		bytes(2, field("total", 2, optional, protoInt64, "")).
+		bytes(2, field("tags", 3, repeated, protoString, "")).
+		bytes(2, field("status", 4, optional, protoEnum, ".shop.Status")).
+		bytes(2, field("item", 5, optional, protoMessageT, ".shop.Item")).
+		bytes(2, field("counts", 6, repeated, protoMessageT, ".shop.Order.CountsEntry")).
+		bytes(2, field("codes", 7, repeated, protoInt32, "")).
+		bytes(2, field("delta", 8, optional, protoSint32, "")).
+		bytes(2, field("price", 9, optional, protoDouble, "")).
+		bytes(2, field("signature", 10, optional, protoBytes, "")).
+		bytes(2, field("gift", 11, optional, protoGroup, ".shop.Item")).
+		bytes(3, countsEntry)
+	item := pb{}.str(1, "Item").
+		bytes(2, field("sku", 1, optional, protoString, "")).
+		bytes(2, field("count", 2, optional, protoInt32, ""))
+	status := pb{}.str(1, "Status").
+		bytes(2, pb{}.str(1, "UNKNOWN").varint(2, 0)).
+		bytes(2, pb{}.str(1, "PAID").varint(2, 1))
+	file := pb{}.str(1, "shop.proto").str(2, "shop").bytes(4, order).bytes(4, item).bytes(5, status)
+	set := pb{}.bytes(1, file)
+
+	proto, err := NewProtobuf(set, []ProtoMapping{{Exchange: "orders", RoutingKey: "order.#", Message: "shop.Order"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		exchange, routingKey, typ, expected string
+	}{
+		{"orders", "order.created.eu", "", "shop.Order"},
+		{"billing", "order.created", "shop.Item", "shop.Item"},
+		{"billing", "order.created", "Item", ""},
+	} {
+		if message, _ := proto.MessageFor(tc.exchange, tc.routingKey, tc.typ); message != tc.expected {
+			t.Errorf("expected %v to be decoded as %q, got %q", tc, tc.expected, message)
+		}
+	}
+
+	body := pb{}.str(1, "o-1").varint(2, 1234).str(3, "new").str(3, "eu").varint(4, 1).
+		bytes(5, pb{}.str(1, "sku-1").varint(2, 2)).
+		bytes(6, pb{}.str(1, "apples").varint(2, 3)).
+		bytes(7, []byte{0x00, 0x07, 0x96, 0x01}). // packed
+		varint(8, 3).double(9, 2.5).bytes(10, []byte{0xca, 0xfe}).
+		group(11, pb{}.str(1, "card")).
+		varint(99, 1).                                            // unknown field
+		group(98, pb{}.varint(1, 1).group(97, pb{}.str(2, "x"))). // unknown groups are skipped
+		bytes(5, pb{}.str(1, "sku-9"))                            // merged into the first item
+
+	decoded, err := proto.Decode("shop.Order", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"@type":"shop.Order","orderId":"o-1","total":"1234","tags":["new","eu"],"status":"PAID",` +
+		`"item":{"sku":"sku-9","count":2},"counts":{"apples":3},"codes":[0,7,150],"delta":-2,"price":2.5,"signature":"yv4=",` +
+		`"gift":{"sku":"card"}}`
+	if string(decoded) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, decoded)
+	}
+
+	if _, err := proto.Decode("shop.Order", body[:len(body)-4]); err == nil {
+		t.Error("expected error for truncated body")
+	}
+	if _, err := proto.Decode("shop.Order", pb{}.group(98, pb{}.varint(1, 1))[:3]); err == nil {
+		t.Error("expected error for a group without its end")
+	}
+}
+
+func TestProtobufWellKnown(t *testing.T) {
+	const optional, repeated = 1, 3
+	message := func(name string, fields ...[]byte) pb {
+		m := pb{}.str(1, name)
+		for _, f := range fields {
+			m = m.bytes(2, f)
+		}
+		return m
+	}
+	valueEntry := message("FieldsEntry",
+		field("key", 1, optional, protoString, ""),
+		field("value", 2, optional, protoMessageT, ".google.protobuf.Value")).
+		bytes(7, pb{}.varint(7, 1))
+	wellKnown := pb{}.str(1, "google/protobuf/well_known.proto").str(2, "google.protobuf").
+		bytes(4, message("Timestamp", field("seconds", 1, optional, protoInt64, ""), field("nanos", 2, optional, protoInt32, ""))).
+		bytes(4, message("Duration", field("seconds", 1, optional, protoInt64, ""), field("nanos", 2, optional, protoInt32, ""))).
+		bytes(4, message("Int64Value", field("value", 1, optional, protoInt64, ""))).
+		bytes(4, message("StringValue", field("value", 1, optional, protoString, ""))).
+		bytes(4, message("Any", field("type_url", 1, optional, protoString, ""), field("value", 2, optional, protoBytes, ""))).
+		bytes(4, message("Struct", field("fields", 1, repeated, protoMessageT, ".google.protobuf.Struct.FieldsEntry")).
+			bytes(3, valueEntry)).
+		bytes(4, message("Value",
+			field("null_value", 1, optional, protoEnum, ".google.protobuf.NullValue"),
+			field("number_value", 2, optional, protoDouble, ""),
+			field("string_value", 3, optional, protoString, ""),
+			field("list_value", 6, optional, protoMessageT, ".google.protobuf.ListValue"))).
+		bytes(4, message("ListValue", field("values", 1, repeated, protoMessageT, ".google.protobuf.Value"))).
+		bytes(5, pb{}.str(1, "NullValue").bytes(2, pb{}.str(1, "NULL_VALUE").varint(2, 0)))
+	event := pb{}.str(1, "events.proto").str(2, "shop").
+		bytes(4, message("Event",
+			field("sent", 1, optional, protoMessageT, ".google.protobuf.Timestamp"),
+			field("timeout", 2, optional, protoMessageT, ".google.protobuf.Duration"),
+			field("retries", 3, optional, protoMessageT, ".google.protobuf.Int64Value"),
+			field("note", 4, optional, protoMessageT, ".google.protobuf.StringValue"),
+			field("attributes", 5, optional, protoMessageT, ".google.protobuf.Struct"),
+			field("payload", 6, repeated, protoMessageT, ".google.protobuf.Any")))
+	proto, err := NewProtobuf(pb{}.bytes(1, wellKnown).bytes(1, event), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attributes := pb{}.
+		bytes(1, pb{}.str(1, "eu").bytes(2, pb{}.varint(1, 0))).
+		bytes(1, pb{}.str(1, "tags").bytes(2, pb{}.bytes(6, pb{}.
+			bytes(1, pb{}.str(3, "a")).
+			bytes(1, pb{}.double(2, 1.5)))))
+	body := pb{}.
+		bytes(1, pb{}.varint(1, 1651933189).varint(2, 21000000)).
+		bytes(2, pb{}.varint(1, uint64(1<<64-2)).varint(2, uint64(1<<64-500000000))). // -2.5s
+		bytes(3, pb{}).
+		bytes(4, pb{}.str(1, "fragile")).
+		bytes(5, attributes).
+		bytes(6, pb{}.str(1, "type.googleapis.com/google.protobuf.Duration").bytes(2, pb{}.varint(1, 30))).
+		bytes(6, pb{}.str(1, "type.googleapis.com/google.protobuf.StringValue").bytes(2, pb{}.str(1, "hi"))).
+		bytes(6, pb{}.str(1, "type.googleapis.com/shop.Missing").bytes(2, []byte{0xca, 0xfe}))
+
+	decoded, err := proto.Decode("shop.Event", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"@type":"shop.Event","sent":"2022-05-07T14:19:49.021Z","timeout":"-2.500s","retries":"0","note":"fragile",` +
+		`"attributes":{"eu":null,"tags":["a",1.5]},"payload":[` +
+		`{"@type":"type.googleapis.com/google.protobuf.Duration","value":"30s"},` +
+		`{"@type":"type.googleapis.com/google.protobuf.StringValue","value":"hi"},` +
+		`{"@type":"type.googleapis.com/shop.Missing","value":"yv4="}]}`
+	if string(decoded) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, decoded)
+	}
+
+	decoded, err = proto.Decode("google.protobuf.Timestamp", pb{}.varint(1, 0))
+	if err != nil || string(decoded) != `{"@type":"google.protobuf.Timestamp","value":"1970-01-01T00:00:00Z"}` {
+		t.Errorf("expected the timestamp as value, got %s: %v", decoded, err)
+	}
+}
@@ -0,0 +1,115 @@
+// Package content renders message bodies for humans based on their properties
+package content
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+)
+
+// Render formats `body` according to `contentType`: JSON is pretty-printed, XML indented and
+// text kept as is. Binary bodies and bodies that are not valid UTF-8 are shown as hex dump
+// followed by their base64 encoding. Bodies that do not match their content type are rendered
+// as if no content type was given.
+func Render(body []byte, contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch {
+	case isJSON(mediaType):
+		if rendered, err := renderJSON(body); err == nil {
+			return rendered
+		}
+	case isXML(mediaType):
+		if rendered, err := renderXML(body); err == nil {
+			return rendered
+		}
+	case mediaType == "application/octet-stream":
+		return renderBinary(body)
+	}
+
+	if !utf8.Valid(body) {
+		return renderBinary(body)
+	}
+
+	return string(body)
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func isXML(mediaType string) bool {
+	return mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+func renderJSON(body []byte) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, body, "", "  "); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// renderXML re-encodes the tokens of `body` with indentation, dropping whitespace between elements
+func renderXML(body []byte) (string, error) {
+	var buf bytes.Buffer
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+
+	for {
+		// raw tokens keep namespace prefixes and xmlns attributes as they were written
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch t := token.(type) {
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) == 0 {
+				continue
+			}
+			token = xml.CharData(bytes.TrimSpace(t))
+		case xml.StartElement:
+			start := xml.StartElement{Name: prefixed(t.Name), Attr: make([]xml.Attr, len(t.Attr))}
+			for i, attr := range t.Attr {
+				start.Attr[i] = xml.Attr{Name: prefixed(attr.Name), Value: attr.Value}
+			}
+			token = start
+		case xml.EndElement:
+			token = xml.EndElement{Name: prefixed(t.Name)}
+		}
+		if err := encoder.EncodeToken(token); err != nil {
+			return "", err
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// prefixed turns the prefix of a raw name into part of its local name, so the encoder writes it
+// unchanged instead of declaring the prefix as a namespace of its own
+func prefixed(name xml.Name) xml.Name {
+	if name.Space == "" {
+		return name
+	}
+
+	return xml.Name{Local: name.Space + ":" + name.Local}
+}
+
+func renderBinary(body []byte) string {
+	return hex.Dump(body) + "base64: " + base64.StdEncoding.EncodeToString(body)
+}
@@ -0,0 +1,29 @@
+package content
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	for _, tc := range []struct {
+		name, contentType, body, expected string
+	}{
+		{"json", "application/json", `{"id":1,"tags":["a"]}`, "{\n  \"id\": 1,\n  \"tags\": [\n    \"a\"\n  ]\n}"},
+		{"json suffix with charset", "application/vnd.api+json; charset=utf-8", `{"id":1}`, "{\n  \"id\": 1\n}"},
+		{"invalid json", "application/json", "Hello World", "Hello World"},
+		{"xml", "text/xml", "<order><id>1</id> <item/></order>", "<order>\n  <id>1</id>\n  <item></item>\n</order>"},
+		{"xml namespaces", "application/soap+xml", `<s:Envelope xmlns:s="http://x/soap"><s:Body><order xmlns="urn:orders" s:id="1"/></s:Body></s:Envelope>`,
+			"<s:Envelope xmlns:s=\"http://x/soap\">\n  <s:Body>\n    <order xmlns=\"urn:orders\" s:id=\"1\"></order>\n  </s:Body>\n</s:Envelope>"},
+		{"mismatched xml", "text/xml", "<a><b></a></b>", "<a><b></a></b>"},
+		{"text", "text/plain", "Hello\nWorld", "Hello\nWorld"},
+		{"no content type", "", "Hello World", "Hello World"},
+		{"octet-stream", "application/octet-stream", "Hi",
+			"00000000  48 69                                             |Hi|\nbase64: SGk="},
+		{"invalid utf-8", "text/plain", "\xca\xfe",
+			"00000000  ca fe                                             |..|\nbase64: yv4="},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if rendered := Render([]byte(tc.body), tc.contentType); rendered != tc.expected {
+				t.Errorf("expected\n%v\ngot\n%v", tc.expected, rendered)
+			}
+		})
+	}
+}
@@ -1,5 +1,5 @@
 module github.com/resamvi/amqparrot
 
-go 1.18
+go 1.21
 
 require github.com/streadway/amqp v1.0.0
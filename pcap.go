@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/resamvi/amqparrot/capture"
+)
+
+func pcapUsage() {
+	fmt.Fprintf(os.Stdout, `usage: amqparrot pcap [flags] <FRAMES> <OUT>
+	--port <PORT>       server port in the exported packets, 0 keeps the recorded one (default 5672)
+`)
+}
+
+// pcap converts a frame file written with --frames to pcapng and returns the exit code
+func pcap(args []string) int {
+	flags := flag.NewFlagSet("pcap", flag.ExitOnError)
+	port := flags.Int("port", 5672, "")
+	flags.Usage = pcapUsage
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		pcapUsage()
+		return 2
+	}
+
+	in, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	defer in.Close()
+
+	out, err := os.Create(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	count, err := capture.ExportPcapng(capture.NewFrameReader(in), out, *port)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Exported %v frames\n", count)
+
+	return 0
+}
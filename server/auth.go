@@ -0,0 +1,108 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/resamvi/amqparrot/amqp"
+	"github.com/resamvi/amqparrot/amqp/server"
+)
+
+var errNoClientCertificate = errors.New("no verified client certificate")
+
+// mechanisms lists the SASL mechanisms offered to the client.
+// EXTERNAL is only offered on TLS connections with a verified client certificate.
+func mechanisms(conn *connection) string {
+	offered := []string{amqp.MechanismAMQPlain, amqp.MechanismPlain}
+	if _, err := certificateUser(conn); err == nil {
+		offered = append([]string{amqp.MechanismExternal}, offered...)
+	}
+
+	return strings.Join(offered, " ")
+}
+
+// authenticate decodes the SASL `response` and continues with connection tuning if the login is valid.
+// Clients sending an empty PLAIN or AMQPLAIN response are challenged with connection.secure first.
+func (s *Server) authenticate(conn *connection, mechanism, response string) error {
+	var (
+		user, pass string
+		external   bool
+		err        error
+	)
+
+	switch mechanism {
+	case amqp.MechanismPlain, amqp.MechanismAMQPlain:
+		if response == "" && conn.mechanism == "" {
+			conn.mechanism = mechanism
+			s.emit(conn, Event{Type: EventConnectionSecure}, ConnectionSecure, mechanism)
+			_, err = conn.Write(server.ConnectionSecure(""))
+			return err
+		}
+
+		if mechanism == amqp.MechanismPlain {
+			user, pass, err = amqp.ParsePlain(response)
+		} else {
+			user, pass, err = amqp.ParseAMQPlain(response)
+		}
+	case amqp.MechanismExternal:
+		user, err = certificateUser(conn)
+		external = true
+	default:
+		return s.closeWith(conn, amqp.CommandInvalid, fmt.Sprintf(
+			"COMMAND_INVALID - unknown authentication mechanism '%v'", mechanism))
+	}
+	if err != nil {
+		return s.closeWith(conn, amqp.AccessRefused, fmt.Sprintf(
+			"ACCESS_REFUSED - Login was refused using authentication mechanism %v: %v", mechanism, err))
+	}
+
+	s.emit(conn, Event{Type: EventConnectionStartOk, User: user}, ConnectionStartOk, user, mechanism)
+	acc, ok := s.login(user, pass, external)
+	if !ok {
+		return s.closeWith(conn, amqp.AccessRefused, fmt.Sprintf(
+			"ACCESS_REFUSED - Login was refused using authentication mechanism %v", mechanism))
+	}
+
+	conn.account = acc
+	conn.mu.Lock()
+	conn.user = user
+	conn.mu.Unlock()
+	_, err = conn.Write(server.ConnectionTune(s.ChannelMax, s.FrameMax, s.heartbeatSeconds()))
+
+	return err
+}
+
+// login checks the credentials against the user store.
+// External logins were already verified by TLS and only need to exist.
+func (s *Server) login(user, pass string, external bool) (*account, bool) {
+	s.usersMu.Lock()
+	defer s.usersMu.Unlock()
+
+	if s.accounts == nil {
+		return nil, true
+	}
+
+	acc, ok := s.accounts[user]
+	if !ok || (!external && !acc.checkPassword(pass)) {
+		return nil, false
+	}
+
+	return acc, true
+}
+
+// certificateUser is the common name of the client's verified TLS certificate
+func certificateUser(conn *connection) (string, error) {
+	tlsConn, ok := conn.Conn.(*tls.Conn)
+	if !ok {
+		return "", errNoClientCertificate
+	}
+
+	chains := tlsConn.ConnectionState().VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return "", errNoClientCertificate
+	}
+
+	return chains[0][0].Subject.CommonName, nil
+}
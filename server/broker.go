@@ -0,0 +1,618 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/resamvi/amqparrot/amqp"
+)
+
+// Exchange types
+const (
+	ExchangeDirect  = "direct"
+	ExchangeFanout  = "fanout"
+	ExchangeTopic   = "topic"
+	ExchangeHeaders = "headers"
+)
+
+// ExchangeInfo describes an exchange declared in a vhost
+type ExchangeInfo struct {
+	VHost      string         `json:"vhost"`
+	Name       string         `json:"name"`
+	Type       string         `json:"type"`
+	Durable    bool           `json:"durable"`
+	AutoDelete bool           `json:"auto_delete"`
+	Internal   bool           `json:"internal"`
+	Arguments  map[string]any `json:"arguments"`
+}
+
+// QueueInfo describes a queue declared in a vhost.
+// amqparrot does not deliver messages, queues only count the messages routed to them and their consumers.
+type QueueInfo struct {
+	VHost      string         `json:"vhost"`
+	Name       string         `json:"name"`
+	Durable    bool           `json:"durable"`
+	Exclusive  bool           `json:"exclusive"`
+	AutoDelete bool           `json:"auto_delete"`
+	Arguments  map[string]any `json:"arguments"`
+	Messages   int            `json:"messages"`
+	// Consumers subscribed with basic.consume
+	Consumers int `json:"consumers"`
+	// Owner is the connection an exclusive queue belongs to
+	Owner uint64 `json:"owner,omitempty"`
+}
+
+// Binding destination types
+const (
+	DestinationQueue    = "queue"
+	DestinationExchange = "exchange"
+)
+
+// BindingInfo describes a binding routing messages from an exchange to a queue or another exchange
+type BindingInfo struct {
+	VHost           string         `json:"vhost"`
+	Source          string         `json:"source"`
+	Destination     string         `json:"destination"`
+	DestinationType string         `json:"destination_type"`
+	RoutingKey      string         `json:"routing_key"`
+	Arguments       map[string]any `json:"arguments"`
+}
+
+// brokerError is a channel error with the reply code the client is told
+type brokerError struct {
+	code uint16
+	text string
+}
+
+func (e *brokerError) Error() string { return e.text }
+
+func notFound(format string, v ...any) error {
+	return &brokerError{amqp.NotFound, "NOT_FOUND - " + fmt.Sprintf(format, v...)}
+}
+
+func accessRefused(format string, v ...any) error {
+	return &brokerError{amqp.AccessRefused, "ACCESS_REFUSED - " + fmt.Sprintf(format, v...)}
+}
+
+func preconditionFailed(format string, v ...any) error {
+	return &brokerError{amqp.PreconditionFailed, "PRECONDITION_FAILED - " + fmt.Sprintf(format, v...)}
+}
+
+func resourceLocked(queue, vhost string) error {
+	return &brokerError{amqp.ResourceLocked, fmt.Sprintf(
+		"RESOURCE_LOCKED - cannot obtain exclusive access to locked queue '%v' in vhost '%v'", queue, vhost)}
+}
+
+// vhost holds everything declared in a virtual host
+type vhost struct {
+	exchanges map[string]*ExchangeInfo
+	queues    map[string]*QueueInfo
+	bindings  []*BindingInfo
+	consumers []*consumer
+}
+
+// consumer is a subscription to a queue made with basic.consume
+type consumer struct {
+	conn      uint64
+	channel   uint16
+	tag       string
+	queue     string
+	exclusive bool
+}
+
+// vhost returns the state of `name`, which must have been created with addVHost.
+// s.brokerMu must be held.
+func (s *Server) vhost(name string) (*vhost, error) {
+	v, ok := s.vhosts[name]
+	if !ok {
+		return nil, notFound("no vhost '%v'", name)
+	}
+
+	return v, nil
+}
+
+// addVHost returns the state of `name`, creating it with the predeclared exchanges.
+// s.brokerMu must be held.
+func (s *Server) addVHost(name string) *vhost {
+	if s.vhosts == nil {
+		s.vhosts = make(map[string]*vhost)
+	}
+	v, ok := s.vhosts[name]
+	if !ok {
+		v = &vhost{exchanges: make(map[string]*ExchangeInfo), queues: make(map[string]*QueueInfo)}
+		for exchange, typ := range map[string]string{
+			"":            ExchangeDirect,
+			"amq.direct":  ExchangeDirect,
+			"amq.fanout":  ExchangeFanout,
+			"amq.topic":   ExchangeTopic,
+			"amq.headers": ExchangeHeaders,
+			"amq.match":   ExchangeHeaders,
+		} {
+			v.exchanges[exchange] = &ExchangeInfo{VHost: name, Name: exchange, Type: typ, Durable: true}
+		}
+		s.vhosts[name] = v
+	}
+
+	return v
+}
+
+// declareExchange creates `e` unless an exchange of that name exists, in which case its type must match.
+// Only the server declares the default exchange and exchanges named amq.*.
+func (s *Server) declareExchange(e ExchangeInfo, passive bool) error {
+	s.brokerMu.Lock()
+	defer s.brokerMu.Unlock()
+
+	v, err := s.vhost(e.VHost)
+	if err != nil {
+		return err
+	}
+	existing, ok := v.exchanges[e.Name]
+	switch {
+	case e.Name == "" && !passive:
+		return accessRefused("operation not permitted on the default exchange")
+	case !ok && passive:
+		return notFound("no exchange '%v' in vhost '%v'", e.Name, e.VHost)
+	case !ok && predeclared(e.Name):
+		return accessRefused("exchange name '%v' contains reserved prefix 'amq.*'", e.Name)
+	case !ok:
+		v.exchanges[e.Name] = &e
+	case !passive && existing.Type != e.Type:
+		return preconditionFailed("inequivalent arg 'type' for exchange '%v' in vhost '%v': received '%v' but current is '%v'",
+			e.Name, e.VHost, e.Type, existing.Type)
+	}
+
+	return nil
+}
+
+// deleteExchange removes an exchange and the bindings it is the source of.
+// The predeclared exchanges cannot be deleted.
+func (s *Server) deleteExchange(vhostName, name string, ifUnused bool) error {
+	s.brokerMu.Lock()
+	defer s.brokerMu.Unlock()
+
+	if name == "" {
+		return accessRefused("operation not permitted on the default exchange")
+	}
+	if predeclared(name) {
+		return accessRefused("deletion of system exchange '%v' in vhost '%v' is not allowed", name, vhostName)
+	}
+	v, err := s.vhost(vhostName)
+	if err != nil {
+		return err
+	}
+	if _, ok := v.exchanges[name]; !ok {
+		return notFound("no exchange '%v' in vhost '%v'", name, vhostName)
+	}
+
+	for _, b := range v.bindings {
+		if ifUnused && b.Source == name {
+			return preconditionFailed("exchange '%v' in vhost '%v' in use", name, vhostName)
+		}
+	}
+	v.remove(DestinationExchange, name)
+
+	return nil
+}
+
+// declareQueue creates `q` unless it exists and returns the declared queue.
+// Queues without name are named by the server, exclusive queues belong to `q.Owner`.
+func (s *Server) declareQueue(q QueueInfo, passive bool) (QueueInfo, error) {
+	s.brokerMu.Lock()
+	defer s.brokerMu.Unlock()
+
+	v, err := s.vhost(q.VHost)
+	if err != nil {
+		return q, err
+	}
+	if q.Name == "" && !passive {
+		q.Name = generateName("amq.gen-")
+	}
+	if !q.Exclusive {
+		q.Owner = 0
+	}
+
+	existing, ok := v.queues[q.Name]
+	switch {
+	case !ok && passive:
+		return q, notFound("no queue '%v' in vhost '%v'", q.Name, q.VHost)
+	case !ok:
+		v.queues[q.Name] = &q
+		return q, nil
+	case existing.Owner != 0 && existing.Owner != q.Owner:
+		return q, resourceLocked(q.Name, q.VHost)
+	}
+
+	return *existing, nil
+}
+
+// reservedQueue refuses queue names clients may not declare, like RabbitMQ does
+func reservedQueue(name string) error {
+	if strings.HasPrefix(name, "amq.") {
+		return accessRefused("queue name '%v' contains reserved prefix 'amq.*'", name)
+	}
+
+	return nil
+}
+
+// deleteQueue removes a queue and its bindings and returns the number of messages it held
+func (s *Server) deleteQueue(vhostName, name string, ifUnused, ifEmpty bool) (int, error) {
+	s.brokerMu.Lock()
+	defer s.brokerMu.Unlock()
+
+	v, err := s.vhost(vhostName)
+	if err != nil {
+		return 0, err
+	}
+	q, ok := v.queues[name]
+	if !ok {
+		return 0, notFound("no queue '%v' in vhost '%v'", name, vhostName)
+	}
+	if ifUnused && q.Consumers > 0 {
+		return 0, preconditionFailed("queue '%v' in vhost '%v' in use", name, vhostName)
+	}
+	if ifEmpty && q.Messages > 0 {
+		return 0, preconditionFailed("queue '%v' in vhost '%v' not empty", name, vhostName)
+	}
+
+	v.remove(DestinationQueue, name)
+
+	return q.Messages, nil
+}
+
+// remove deletes the queue or exchange `name` and all bindings from or to it
+func (v *vhost) remove(typ, name string) {
+	bindings := v.bindings[:0]
+	for _, b := range v.bindings {
+		from := typ == DestinationExchange && b.Source == name
+		to := b.DestinationType == typ && b.Destination == name
+		if !from && !to {
+			bindings = append(bindings, b)
+		}
+	}
+	v.bindings = bindings
+
+	if typ == DestinationQueue {
+		delete(v.queues, name)
+		v.dropConsumers(func(c *consumer) bool { return c.queue == name })
+	} else {
+		delete(v.exchanges, name)
+	}
+}
+
+// PurgeQueue drops all messages of a queue and returns their number
+func (s *Server) PurgeQueue(vhostName, name string) (int, error) {
+	s.brokerMu.Lock()
+	defer s.brokerMu.Unlock()
+
+	v, err := s.vhost(vhostName)
+	if err != nil {
+		return 0, err
+	}
+	q, ok := v.queues[name]
+	if !ok {
+		return 0, notFound("no queue '%v' in vhost '%v'", name, vhostName)
+	}
+	purged := q.Messages
+	q.Messages = 0
+
+	return purged, nil
+}
+
+// bind adds a binding unless the same binding exists
+func (s *Server) bind(b BindingInfo) error {
+	s.brokerMu.Lock()
+	defer s.brokerMu.Unlock()
+
+	v, err := s.vhost(b.VHost)
+	if err != nil {
+		return err
+	}
+	if _, ok := v.exchanges[b.Source]; !ok {
+		return notFound("no exchange '%v' in vhost '%v'", b.Source, b.VHost)
+	}
+	if err := v.destination(b); err != nil {
+		return err
+	}
+	if v.binding(b) < 0 {
+		v.bindings = append(v.bindings, &b)
+	}
+
+	return nil
+}
+
+// unbind removes a binding; removing a binding that does not exist is fine
+func (s *Server) unbind(b BindingInfo) error {
+	s.brokerMu.Lock()
+	defer s.brokerMu.Unlock()
+
+	v, err := s.vhost(b.VHost)
+	if err != nil {
+		return err
+	}
+	if err := v.destination(b); err != nil {
+		return err
+	}
+	if i := v.binding(b); i >= 0 {
+		v.bindings = append(v.bindings[:i], v.bindings[i+1:]...)
+	}
+
+	return nil
+}
+
+// destination checks that the destination of `b` exists
+func (v *vhost) destination(b BindingInfo) error {
+	if b.DestinationType == DestinationExchange {
+		if _, ok := v.exchanges[b.Destination]; !ok {
+			return notFound("no exchange '%v' in vhost '%v'", b.Destination, b.VHost)
+		}
+		return nil
+	}
+	if _, ok := v.queues[b.Destination]; !ok {
+		return notFound("no queue '%v' in vhost '%v'", b.Destination, b.VHost)
+	}
+
+	return nil
+}
+
+// binding returns the index of the binding equal to `b`, or -1
+func (v *vhost) binding(b BindingInfo) int {
+	for i, existing := range v.bindings {
+		if existing.Source == b.Source && existing.Destination == b.Destination &&
+			existing.DestinationType == b.DestinationType && existing.RoutingKey == b.RoutingKey &&
+			fmt.Sprint(existing.Arguments) == fmt.Sprint(b.Arguments) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// route counts a message for every queue it is routed to and returns their names.
+// Messages to unknown exchanges or vhosts are not routed anywhere.
+func (s *Server) route(vhostName, exchange, routingKey string, headers map[string]any) []string {
+	s.brokerMu.Lock()
+	defer s.brokerMu.Unlock()
+
+	v, err := s.vhost(vhostName)
+	if err != nil {
+		return nil
+	}
+	matched := make(map[string]bool)
+	v.routeVia(exchange, routingKey, headers, matched, make(map[string]bool))
+
+	queues := make([]string, 0, len(matched))
+	for name := range matched {
+		v.queues[name].Messages++
+		queues = append(queues, name)
+	}
+	sort.Strings(queues)
+
+	return queues
+}
+
+// routeVia adds the queues `exchange` routes to to `matched`, following exchange to exchange bindings
+func (v *vhost) routeVia(exchange, routingKey string, headers map[string]any, matched, visited map[string]bool) {
+	e, ok := v.exchanges[exchange]
+	if !ok || visited[exchange] {
+		return
+	}
+	visited[exchange] = true
+
+	if exchange == "" { // the default exchange binds every queue by its name
+		if _, ok := v.queues[routingKey]; ok {
+			matched[routingKey] = true
+		}
+	}
+	for _, b := range v.bindings {
+		if b.Source != exchange || !routes(e.Type, b, routingKey, headers) {
+			continue
+		}
+		if b.DestinationType == DestinationExchange {
+			v.routeVia(b.Destination, routingKey, headers, matched, visited)
+		} else {
+			matched[b.Destination] = true
+		}
+	}
+}
+
+// routes reports whether a message with `routingKey` and `headers` matches binding `b` of an exchange of type `typ`
+func routes(typ string, b *BindingInfo, routingKey string, headers map[string]any) bool {
+	switch typ {
+	case ExchangeFanout:
+		return true
+	case ExchangeTopic:
+		return amqp.MatchTopic(b.RoutingKey, routingKey)
+	case ExchangeHeaders:
+		return matchHeaders(b.Arguments, headers)
+	}
+
+	return b.RoutingKey == routingKey
+}
+
+// matchHeaders implements the x-match argument of headers exchanges, which defaults to all
+func matchHeaders(arguments, headers map[string]any) bool {
+	matchAny := arguments["x-match"] == "any"
+
+	for name, value := range arguments {
+		if strings.HasPrefix(name, "x-") {
+			continue
+		}
+		header, ok := headers[name]
+		matches := ok && fmt.Sprint(header) == fmt.Sprint(value)
+		if matchAny && matches {
+			return true
+		}
+		if !matchAny && !matches {
+			return false
+		}
+	}
+
+	return !matchAny
+}
+
+// consume subscribes `c` to its queue in `vhostName` and returns its tag.
+// amqparrot does not deliver messages, queues only count their consumers.
+func (s *Server) consume(vhostName string, c consumer) (string, error) {
+	s.brokerMu.Lock()
+	defer s.brokerMu.Unlock()
+
+	v, err := s.vhost(vhostName)
+	if err != nil {
+		return "", err
+	}
+	q, ok := v.queues[c.queue]
+	switch {
+	case !ok:
+		return "", notFound("no queue '%v' in vhost '%v'", c.queue, vhostName)
+	case q.Owner != 0 && q.Owner != c.conn:
+		return "", resourceLocked(c.queue, vhostName)
+	}
+	if c.tag == "" {
+		c.tag = generateName("amq.ctag-")
+	}
+	for _, other := range v.consumers {
+		switch {
+		case other.conn == c.conn && other.channel == c.channel && other.tag == c.tag:
+			return "", &brokerError{amqp.NotAllowed, fmt.Sprintf("NOT_ALLOWED - attempt to reuse consumer tag '%v'", c.tag)}
+		case other.queue == c.queue && (other.exclusive || c.exclusive):
+			return "", accessRefused("queue '%v' in vhost '%v' in exclusive use", c.queue, vhostName)
+		}
+	}
+
+	v.consumers = append(v.consumers, &c)
+	q.Consumers++
+
+	return c.tag, nil
+}
+
+// cancel removes the consumers of connection `id` that `match` selects and returns their queues
+func (s *Server) cancel(id uint64, match func(c *consumer) bool) []string {
+	s.brokerMu.Lock()
+	defer s.brokerMu.Unlock()
+
+	var queues []string
+	for _, v := range s.vhosts {
+		for _, c := range v.dropConsumers(func(c *consumer) bool { return c.conn == id && match(c) }) {
+			queues = append(queues, c.queue)
+		}
+	}
+
+	return queues
+}
+
+// onChannel selects the consumers of `channel`
+func onChannel(channel uint16) func(c *consumer) bool {
+	return func(c *consumer) bool { return c.channel == channel }
+}
+
+// dropConsumers removes the consumers `match` selects from their queues and returns them
+func (v *vhost) dropConsumers(match func(c *consumer) bool) []*consumer {
+	var dropped []*consumer
+	kept := v.consumers[:0]
+	for _, c := range v.consumers {
+		if !match(c) {
+			kept = append(kept, c)
+			continue
+		}
+		if q, ok := v.queues[c.queue]; ok {
+			q.Consumers--
+		}
+		dropped = append(dropped, c)
+	}
+	v.consumers = kept
+
+	return dropped
+}
+
+// dropExclusive deletes the exclusive queues of connection `id`
+func (s *Server) dropExclusive(id uint64) {
+	s.brokerMu.Lock()
+	defer s.brokerMu.Unlock()
+
+	for _, v := range s.vhosts {
+		for name, q := range v.queues {
+			if q.Owner == id {
+				v.remove(DestinationQueue, name)
+			}
+		}
+	}
+}
+
+// generateName names queues declared without name or consumers without tag like RabbitMQ does,
+// e.g. with the prefix amq.gen- or amq.ctag-
+func generateName(prefix string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return prefix + base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Exchanges returns the exchanges of `vhost`, or of all vhosts if empty, ordered by vhost and name
+func (s *Server) Exchanges(vhost string) []ExchangeInfo {
+	s.brokerMu.Lock()
+	defer s.brokerMu.Unlock()
+
+	var exchanges []ExchangeInfo
+	for name, v := range s.vhosts {
+		if vhost != "" && name != vhost {
+			continue
+		}
+		for _, e := range v.exchanges {
+			exchanges = append(exchanges, *e)
+		}
+	}
+	sort.Slice(exchanges, func(i, j int) bool {
+		a, b := exchanges[i], exchanges[j]
+		return a.VHost < b.VHost || a.VHost == b.VHost && a.Name < b.Name
+	})
+
+	return exchanges
+}
+
+// Queues returns the queues of `vhost`, or of all vhosts if empty, ordered by vhost and name
+func (s *Server) Queues(vhost string) []QueueInfo {
+	s.brokerMu.Lock()
+	defer s.brokerMu.Unlock()
+
+	var queues []QueueInfo
+	for name, v := range s.vhosts {
+		if vhost != "" && name != vhost {
+			continue
+		}
+		for _, q := range v.queues {
+			queues = append(queues, *q)
+		}
+	}
+	sort.Slice(queues, func(i, j int) bool {
+		a, b := queues[i], queues[j]
+		return a.VHost < b.VHost || a.VHost == b.VHost && a.Name < b.Name
+	})
+
+	return queues
+}
+
+// Bindings returns the bindings of `vhost`, or of all vhosts if empty, in the order they were created
+func (s *Server) Bindings(vhost string) []BindingInfo {
+	s.brokerMu.Lock()
+	defer s.brokerMu.Unlock()
+
+	names := make([]string, 0, len(s.vhosts))
+	for name := range s.vhosts {
+		if vhost == "" || name == vhost {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var bindings []BindingInfo
+	for _, name := range names {
+		for _, b := range s.vhosts[name].bindings {
+			bindings = append(bindings, *b)
+		}
+	}
+
+	return bindings
+}
@@ -0,0 +1,311 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/resamvi/amqparrot/amqp"
+	"github.com/resamvi/amqparrot/amqp/client"
+	"github.com/resamvi/amqparrot/amqp/server"
+	"github.com/resamvi/amqparrot/capture"
+)
+
+const (
+	// missedHeartbeats is the number of heartbeat intervals a client may stay
+	// silent before its connection is considered dead
+	missedHeartbeats = 2
+
+	// closeTimeout is how long to wait for connection.close-ok after closing a connection
+	closeTimeout = 5 * time.Second
+
+	// handshakeTimeout is how long to wait for the protocol header of a new connection
+	handshakeTimeout = 10 * time.Second
+
+	// lingerTimeout is how long to keep reading after the server finished a connection,
+	// so that the last frames reach the client instead of being dropped by a reset
+	lingerTimeout = 1 * time.Second
+)
+
+// connection holds the state amqparrot keeps for a single client
+type connection struct {
+	net.Conn
+
+	// id identifies the connection in the control API
+	id uint64
+
+	// writeMu serializes frames written by the handler and the heartbeater
+	writeMu sync.Mutex
+
+	// heartbeat is the negotiated interval as time.Duration; 0 if disabled
+	heartbeat int64
+
+	// negotiated limits, read by the frame reader
+	channelMaxLimit uint32
+	frameMaxLimit   uint32
+
+	// closing is set to 1 once the server sent connection.close
+	closing int32
+
+	// readErr is the error that stopped reading from the client
+	readErr error
+
+	// done is closed once the connection is torn down
+	done chan struct{}
+
+	// observe is called with every complete frame read from or written to the client, if set
+	observe func(direction string, frame []byte)
+
+	// mu guards the fields below which are also accessed by the control API
+	mu sync.Mutex
+
+	user  string
+	vhost string
+
+	// blockable is set if the client announced support for connection.blocked
+	blockable bool
+
+	// blocked is set while the client was told to stop publishing
+	blocked bool
+
+	// channels that were opened and not closed yet
+	channels map[uint16]*channel
+
+	// publishes whose content is not received completely yet, by channel
+	publishes map[uint16]*publish
+
+	// mechanism the client is challenged for with connection.secure
+	mechanism string
+
+	// account the client logged in with; nil without user store
+	account *account
+
+	// closed is set once the client asked to close the connection
+	closed bool
+}
+
+// channel holds the state of a channel opened by a client
+type channel struct {
+	// flow is false while the client was asked to pause publishing
+	flow bool
+
+	// closing is set once the server sent channel.close
+	closing bool
+}
+
+// inbound is a message read from the client along with the channel it was sent on
+type inbound struct {
+	channel uint16
+	message client.Message
+}
+
+// publish is a message whose header and body frames are still being received
+type publish struct {
+	client.BasicPublish
+	size       uint64
+	properties client.Properties
+	body       []byte
+}
+
+func newConnection(id uint64, conn net.Conn, channelMax uint16, frameMax uint32) *connection {
+	c := &connection{
+		Conn:      conn,
+		id:        id,
+		done:      make(chan struct{}),
+		channels:  make(map[uint16]*channel),
+		publishes: make(map[uint16]*publish),
+	}
+	c.setLimits(channelMax, frameMax)
+
+	return c
+}
+
+// Read reads from the client and fails if the client missed too many heartbeats
+func (c *connection) Read(b []byte) (int, error) {
+	if interval := c.heartbeatInterval(); interval > 0 && !c.isClosing() {
+		c.Conn.SetReadDeadline(time.Now().Add(missedHeartbeats * interval))
+	}
+
+	n, err := c.Conn.Read(b)
+	if err != nil {
+		c.readErr = err
+	}
+
+	return n, err
+}
+
+// Write sends b to the client without interleaving with other frames
+func (c *connection) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.observe != nil {
+		c.observe(capture.Outbound, b)
+	}
+
+	return c.Conn.Write(b)
+}
+
+func (c *connection) heartbeatInterval() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.heartbeat))
+}
+
+// startHeartbeat sends a heartbeat frame every `interval` until the connection is done
+func (c *connection) startHeartbeat(interval time.Duration) {
+	atomic.StoreInt64(&c.heartbeat, int64(interval))
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-ticker.C:
+				if _, err := c.Write(server.Heartbeat); err != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// setLimits stores the negotiated channel-max and frame-max where 0 means no limit
+func (c *connection) setLimits(channelMax uint16, frameMax uint32) {
+	atomic.StoreUint32(&c.channelMaxLimit, uint32(channelMax))
+	atomic.StoreUint32(&c.frameMaxLimit, frameMax)
+}
+
+func (c *connection) channelMax() uint16 {
+	return uint16(atomic.LoadUint32(&c.channelMaxLimit))
+}
+
+func (c *connection) frameMax() uint32 {
+	return atomic.LoadUint32(&c.frameMaxLimit)
+}
+
+// startClosing stops waiting for heartbeats and gives the client closeTimeout to confirm the close
+func (c *connection) startClosing() {
+	atomic.StoreInt32(&c.closing, 1)
+	c.Conn.SetReadDeadline(time.Now().Add(closeTimeout))
+}
+
+// finish stops sending to the client and waits at most lingerTimeout for the client to hang up
+func (c *connection) finish() {
+	atomic.StoreInt32(&c.closing, 1)
+	if conn, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		conn.CloseWrite()
+	}
+	c.Conn.SetReadDeadline(time.Now().Add(lingerTimeout))
+}
+
+func (c *connection) isClosing() bool {
+	return atomic.LoadInt32(&c.closing) == 1
+}
+
+// readFrames parses all frames the client sends until the connection is closed.
+// Frames violating the negotiated limits are reported as client.Invalid with a connection error code.
+func (c *connection) readFrames() chan inbound {
+	stream := make(chan inbound)
+	go func() {
+		defer close(stream)
+
+		c.Conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+		header, err := amqp.ReadProtocolHeader(c)
+		if err != nil {
+			return
+		}
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.observe != nil {
+			c.observe(capture.Inbound, header)
+		}
+
+		if !bytes.Equal(header, amqp.Hello) {
+			stream <- inbound{amqp.GlobalChannel, client.UnsupportedProtocol{Header: header}}
+			io.Copy(io.Discard, c) // whatever else the client sent until the connection is finished
+			return
+		}
+		stream <- inbound{amqp.GlobalChannel, client.Hello{}}
+
+		for {
+			frame, err := amqp.ReadFrame(c, c.frameMax())
+
+			var tooLarge *amqp.FrameTooLargeError
+			switch {
+			case errors.As(err, &tooLarge):
+				stream <- inbound{tooLarge.Channel, client.Invalid{Code: amqp.FrameError, Err: err.Error()}}
+				continue
+
+			case errors.Is(err, amqp.ErrFrameEnd): // cannot find the next frame anymore
+				stream <- inbound{amqp.GlobalChannel, client.Invalid{Code: amqp.FrameError, Err: err.Error()}}
+				return
+
+			case err != nil:
+				return
+			}
+
+			if c.observe != nil {
+				c.observe(capture.Inbound, append(frame[:len(frame):len(frame)], amqp.EndMark))
+			}
+
+			channel := amqp.FrameChannel(frame)
+			if max := c.channelMax(); max > 0 && channel > max {
+				stream <- inbound{channel, client.Invalid{
+					Code: amqp.NotAllowed,
+					Err:  fmt.Sprintf("channel %v exceeds channel-max of %v", channel, max),
+				}}
+				continue
+			}
+
+			message := amqp.Parse(frame)
+			if invalid, ok := message.(client.Invalid); ok && invalid.Code == 0 {
+				invalid.Err = fmt.Sprintf("%v in %v\n%v", invalid.Err, amqp.Describe(frame), strings.TrimSuffix(hex.Dump(frame), "\n"))
+				message = invalid
+			}
+			stream <- inbound{channel, message}
+		}
+	}()
+
+	return stream
+}
+
+// discards reports whether `message` is ignored because the server is closing its channel.
+// Only channel.close and channel.close-ok are handled on such channels.
+func (c *connection) discards(in inbound) bool {
+	switch in.message.(type) {
+	case client.ChannelClose, client.ChannelCloseOk:
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch, ok := c.channels[in.channel]
+	return ok && ch.closing
+}
+
+// openChannels returns the ids of all channels still open in ascending order
+func (c *connection) openChannels() []uint16 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ids := make([]uint16, 0, len(c.channels))
+	for id := range c.channels {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids
+}
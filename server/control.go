@@ -0,0 +1,182 @@
+package server
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/resamvi/amqparrot/amqp"
+	"github.com/resamvi/amqparrot/amqp/client"
+	"github.com/resamvi/amqparrot/amqp/server"
+)
+
+var (
+	ErrUnknownConnection = errors.New("unknown connection")
+	ErrUnknownChannel    = errors.New("unknown channel")
+	ErrNotBlockable      = errors.New("client does not support connection.blocked")
+)
+
+// ConnectionInfo describes an open client connection
+type ConnectionInfo struct {
+	ID         uint64        `json:"id"`
+	RemoteAddr string        `json:"remote_addr"`
+	User       string        `json:"user"`
+	VHost      string        `json:"vhost"`
+	Blocked    bool          `json:"blocked"`
+	Channels   []ChannelInfo `json:"channels"`
+}
+
+// ChannelInfo describes an open channel of a client connection
+type ChannelInfo struct {
+	Connection uint64 `json:"connection"`
+	ID         uint16 `json:"id"`
+	Flow       bool   `json:"flow"`
+}
+
+// Connections returns all open connections ordered by id
+func (s *Server) Connections() []ConnectionInfo {
+	s.mu.Lock()
+	conns := make([]*connection, 0, len(s.conns))
+	for _, c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	sort.Slice(conns, func(i, j int) bool { return conns[i].id < conns[j].id })
+
+	infos := make([]ConnectionInfo, 0, len(conns))
+	for _, c := range conns {
+		c.mu.Lock()
+		info := ConnectionInfo{
+			ID:         c.id,
+			RemoteAddr: c.RemoteAddr().String(),
+			User:       c.user,
+			VHost:      c.vhost,
+			Blocked:    c.blocked,
+			Channels:   make([]ChannelInfo, 0, len(c.channels)),
+		}
+		for id, ch := range c.channels {
+			info.Channels = append(info.Channels, ChannelInfo{Connection: c.id, ID: id, Flow: ch.flow})
+		}
+		c.mu.Unlock()
+
+		sort.Slice(info.Channels, func(i, j int) bool { return info.Channels[i].ID < info.Channels[j].ID })
+		infos = append(infos, info)
+	}
+
+	return infos
+}
+
+// Channels returns the open channels of all connections ordered by connection and channel id
+func (s *Server) Channels() []ChannelInfo {
+	channels := make([]ChannelInfo, 0)
+	for _, c := range s.Connections() {
+		channels = append(channels, c.Channels...)
+	}
+
+	return channels
+}
+
+// Block sends connection.blocked to the client, like RabbitMQ does when a resource alarm goes off
+func (s *Server) Block(id uint64, reason string) error {
+	c, err := s.connection(id)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	blockable := c.blockable
+	if blockable {
+		c.blocked = true
+	}
+	c.mu.Unlock()
+	if !blockable {
+		return ErrNotBlockable
+	}
+
+	s.emit(c, Event{Type: EventConnectionBlocked}, ConnectionBlocked, c.RemoteAddr(), reason)
+	_, err = c.Write(server.ConnectionBlocked(reason))
+
+	return err
+}
+
+// Unblock sends connection.unblocked to the client
+func (s *Server) Unblock(id uint64) error {
+	c, err := s.connection(id)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	blockable := c.blockable
+	c.blocked = false
+	c.mu.Unlock()
+	if !blockable {
+		return ErrNotBlockable
+	}
+
+	s.emit(c, Event{Type: EventConnectionUnblocked}, ConnectionUnblocked, c.RemoteAddr())
+	_, err = c.Write(server.ConnectionUnblocked)
+
+	return err
+}
+
+// Flow sends channel.flow to the client asking it to pause (active=false) or resume publishing on a channel
+func (s *Server) Flow(id uint64, channel uint16, active bool) error {
+	c, err := s.connection(id)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	ch, ok := c.channels[channel]
+	if ok {
+		ch.flow = active
+	}
+	c.mu.Unlock()
+	if !ok {
+		return ErrUnknownChannel
+	}
+
+	s.emit(c, Event{Type: EventChannelFlow, Channel: channel}, ChannelFlow, channel, active)
+	_, err = c.Write(server.ChannelFlow(channel, active))
+
+	return err
+}
+
+// CloseConnection closes a connection with CONNECTION_FORCED, like an operator closing it in RabbitMQ
+func (s *Server) CloseConnection(id uint64, reason string) error {
+	c, err := s.connection(id)
+	if err != nil {
+		return err
+	}
+
+	return s.closeWith(c, amqp.ConnectionForced, "CONNECTION_FORCED - "+reason)
+}
+
+// Publish handles a message as if a client had published it to `exchange` in `vhost`:
+// it is logged, recorded and routed to queues. The vhost must exist.
+func (s *Server) Publish(vhost, exchange, routingKey string, properties client.Properties, body []byte) error {
+	if !s.hasVHost(vhost) {
+		return notFound("no vhost '%v'", vhost)
+	}
+
+	s.received(nil, vhost, &publish{
+		BasicPublish: client.BasicPublish{Exchange: exchange, RoutingKey: routingKey},
+		size:         uint64(len(body)),
+		properties:   properties,
+		body:         body,
+	})
+
+	return nil
+}
+
+func (s *Server) connection(id uint64) (*connection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.conns[id]
+	if !ok {
+		return nil, ErrUnknownConnection
+	}
+
+	return c, nil
+}
@@ -0,0 +1,329 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Definitions is the topology of the server in the format of RabbitMQ's definitions export
+type Definitions struct {
+	RabbitVersion string                 `json:"rabbit_version,omitempty"`
+	Users         []UserDefinition       `json:"users"`
+	VHosts        []VHostDefinition      `json:"vhosts"`
+	Permissions   []PermissionDefinition `json:"permissions"`
+	Queues        []QueueDefinition      `json:"queues"`
+	Exchanges     []ExchangeInfo         `json:"exchanges"`
+	Bindings      []BindingInfo          `json:"bindings"`
+}
+
+// VHostDefinition is a vhost in the definitions
+type VHostDefinition struct {
+	Name string `json:"name"`
+}
+
+// UserDefinition is a user in the definitions; RabbitMQ only exports password hashes
+type UserDefinition struct {
+	Name             string  `json:"name"`
+	PasswordHash     string  `json:"password_hash"`
+	HashingAlgorithm string  `json:"hashing_algorithm"`
+	Tags             tagList `json:"tags"`
+}
+
+// tagList reads tags both as list and as comma separated string like older RabbitMQ versions export them
+type tagList []string
+
+func (t *tagList) UnmarshalJSON(data []byte) error {
+	var tags string
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return json.Unmarshal(data, (*[]string)(t))
+	}
+
+	*t = tagList{}
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			*t = append(*t, tag)
+		}
+	}
+
+	return nil
+}
+
+// PermissionDefinition holds the permissions of a user in a vhost
+type PermissionDefinition struct {
+	User      string `json:"user"`
+	VHost     string `json:"vhost"`
+	Configure string `json:"configure"`
+	Write     string `json:"write"`
+	Read      string `json:"read"`
+}
+
+// QueueDefinition is a queue in the definitions, which unlike QueueInfo holds no state
+type QueueDefinition struct {
+	VHost      string         `json:"vhost"`
+	Name       string         `json:"name"`
+	Durable    bool           `json:"durable"`
+	AutoDelete bool           `json:"auto_delete"`
+	Arguments  map[string]any `json:"arguments"`
+}
+
+// rabbitVersion is the RabbitMQ version amqparrot claims to be towards management tools
+const rabbitVersion = "3.12.0"
+
+// LoadDefinitions reads a definitions file as exported by RabbitMQ
+func LoadDefinitions(path string) (*Definitions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read definitions: %w", err)
+	}
+
+	var d Definitions
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("could not parse definitions: %w", err)
+	}
+
+	return &d, nil
+}
+
+// Definitions exports the users and all vhosts with their permissions, exchanges, queues and bindings.
+// Predeclared exchanges and exclusive queues are left out like RabbitMQ does.
+func (s *Server) Definitions() Definitions {
+	d := Definitions{
+		RabbitVersion: rabbitVersion,
+		Users:         []UserDefinition{},
+		VHosts:        []VHostDefinition{},
+		Permissions:   []PermissionDefinition{},
+		Queues:        []QueueDefinition{},
+		Exchanges:     []ExchangeInfo{},
+		Bindings:      nonNil(s.Bindings("")),
+	}
+	s.usersMu.Lock()
+	users := s.Users
+	s.usersMu.Unlock()
+	for _, u := range users {
+		// passwords were hashed once when the server started or imported the user
+		user := UserDefinition{Name: u.Name, PasswordHash: u.PasswordHash, HashingAlgorithm: u.HashingAlgorithm, Tags: u.Tags}
+		if user.HashingAlgorithm == "" {
+			user.HashingAlgorithm = HashingSHA256
+		}
+		if user.Tags == nil {
+			user.Tags = tagList{}
+		}
+		d.Users = append(d.Users, user)
+
+		for vhost, p := range u.Permissions {
+			d.Permissions = append(d.Permissions, PermissionDefinition{
+				User: u.Name, VHost: vhost, Configure: p.Configure, Write: p.Write, Read: p.Read,
+			})
+		}
+	}
+	sort.Slice(d.Permissions, func(i, j int) bool {
+		a, b := d.Permissions[i], d.Permissions[j]
+		return a.User < b.User || a.User == b.User && a.VHost < b.VHost
+	})
+	for _, name := range s.VHosts() {
+		d.VHosts = append(d.VHosts, VHostDefinition{Name: name})
+	}
+	for _, e := range s.Exchanges("") {
+		if !predeclared(e.Name) {
+			d.Exchanges = append(d.Exchanges, e)
+		}
+	}
+	for _, q := range s.Queues("") {
+		if !q.Exclusive {
+			d.Queues = append(d.Queues, QueueDefinition{
+				VHost:      q.VHost,
+				Name:       q.Name,
+				Durable:    q.Durable,
+				AutoDelete: q.AutoDelete,
+				Arguments:  q.Arguments,
+			})
+		}
+	}
+
+	return d
+}
+
+// users converts the users of the definitions along with their permissions
+func (d *Definitions) users() []User {
+	users := make([]User, 0, len(d.Users))
+	for _, u := range d.Users {
+		user := User{
+			Name:             u.Name,
+			PasswordHash:     u.PasswordHash,
+			HashingAlgorithm: u.HashingAlgorithm,
+			Tags:             u.Tags,
+			Permissions:      make(map[string]Permission),
+		}
+		for _, p := range d.Permissions {
+			if p.User == u.Name {
+				user.Permissions[p.VHost] = Permission{Configure: p.Configure, Write: p.Write, Read: p.Read}
+			}
+		}
+		users = append(users, user)
+	}
+
+	return users
+}
+
+// ImportDefinitions declares the vhosts, exchanges, queues and bindings in `d` that do not exist yet
+// and adds its users, replacing users of the same name. Permissions of users missing in `d` are
+// added to the existing users. Once there are users, only they can log in.
+// If any part of `d` is invalid, nothing is imported.
+func (s *Server) ImportDefinitions(d Definitions) error {
+	s.usersMu.Lock()
+	defer s.usersMu.Unlock()
+
+	users, accounts, err := s.importedUsers(d)
+	if err != nil {
+		return err
+	}
+	// declaring on a copy first finds invalid exchanges, queues and bindings before anything changed
+	if err := s.topology().declare(d); err != nil {
+		return err
+	}
+	if err := s.declare(d); err != nil {
+		return err
+	}
+	if users != nil {
+		s.Users, s.accounts = users, accounts
+	}
+
+	return nil
+}
+
+// topology returns a server holding a copy of the vhosts, exchanges, queues and bindings
+func (s *Server) topology() *Server {
+	c := &Server{}
+	for _, name := range s.VHosts() {
+		c.AddVHost(name)
+	}
+	for _, e := range s.Exchanges("") {
+		if !predeclared(e.Name) {
+			c.declareExchange(e, false)
+		}
+	}
+	for _, q := range s.Queues("") {
+		c.declareQueue(q, false)
+	}
+	for _, b := range s.Bindings("") {
+		c.bind(b)
+	}
+
+	return c
+}
+
+// declare declares the vhosts, exchanges, queues and bindings of `d`
+func (s *Server) declare(d Definitions) error {
+	for _, v := range d.VHosts {
+		s.AddVHost(v.Name)
+	}
+	for _, e := range d.Exchanges {
+		if predeclared(e.Name) {
+			continue
+		}
+		if err := s.declareExchange(e, false); err != nil {
+			return fmt.Errorf("exchange %q: %w", e.Name, err)
+		}
+	}
+	for _, q := range d.Queues {
+		_, err := s.declareQueue(QueueInfo{
+			VHost:      q.VHost,
+			Name:       q.Name,
+			Durable:    q.Durable,
+			AutoDelete: q.AutoDelete,
+			Arguments:  q.Arguments,
+		}, false)
+		if err != nil {
+			return fmt.Errorf("queue %q: %w", q.Name, err)
+		}
+	}
+	for _, b := range d.Bindings {
+		if b.DestinationType == "" {
+			b.DestinationType = DestinationQueue
+		}
+		if err := s.bind(b); err != nil {
+			return fmt.Errorf("binding of %q to %q: %w", b.Source, b.Destination, err)
+		}
+	}
+
+	return nil
+}
+
+// importedUsers merges the users and permissions of `d` into Users and compiles the result.
+// It returns nil users if `d` has neither. s.usersMu must be held.
+func (s *Server) importedUsers(d Definitions) ([]User, map[string]*account, error) {
+	if len(d.Users) == 0 && len(d.Permissions) == 0 {
+		return nil, nil, nil
+	}
+
+	users := mergeUsers(s.Users, hashPasswords(d.users()))
+	for _, p := range d.Permissions {
+		imported := false
+		for _, u := range d.Users {
+			imported = imported || u.Name == p.User
+		}
+		if imported {
+			continue // d.users() added the permission to the user
+		}
+
+		i := 0
+		for i < len(users) && users[i].Name != p.User {
+			i++
+		}
+		if i == len(users) {
+			return nil, nil, fmt.Errorf("permission of unknown user %q", p.User)
+		}
+
+		permissions := make(map[string]Permission, len(users[i].Permissions)+1)
+		for vhost, existing := range users[i].Permissions {
+			permissions[vhost] = existing
+		}
+		permissions[p.VHost] = Permission{Configure: p.Configure, Write: p.Write, Read: p.Read}
+		users[i].Permissions = permissions
+	}
+
+	accounts, err := compileUsers(users)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid users: %w", err)
+	}
+
+	return users, accounts, nil
+}
+
+// AddVHost creates a vhost with the predeclared exchanges unless it exists
+func (s *Server) AddVHost(name string) {
+	s.brokerMu.Lock()
+	s.addVHost(name)
+	s.brokerMu.Unlock()
+}
+
+// VHosts returns the names of all vhosts in order
+func (s *Server) VHosts() []string {
+	s.brokerMu.Lock()
+	defer s.brokerMu.Unlock()
+
+	names := make([]string, 0, len(s.vhosts))
+	for name := range s.vhosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// hasVHost reports whether the vhost `name` exists
+func (s *Server) hasVHost(name string) bool {
+	s.brokerMu.Lock()
+	defer s.brokerMu.Unlock()
+
+	_, ok := s.vhosts[name]
+	return ok
+}
+
+// predeclared reports whether every vhost has the exchange `name` from the start
+func predeclared(name string) bool {
+	return name == "" || strings.HasPrefix(name, "amq.")
+}
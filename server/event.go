@@ -0,0 +1,223 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/resamvi/amqparrot/amqp/client"
+)
+
+// Output formats of the server log
+const (
+	// FormatText prints the log lines defined next to Server
+	FormatText = "text"
+	// FormatJSON prints one JSON object per line and event
+	FormatJSON = "json"
+)
+
+// EventType names what happened in an Event
+type EventType string
+
+const (
+	EventStarted             EventType = "server.started"
+	EventServerError         EventType = "server.error"
+	EventConnectionAccepted  EventType = "connection.accepted"
+	EventHello               EventType = "connection.hello"
+	EventUnsupportedProtocol EventType = "connection.unsupported-protocol"
+	EventConnectionSecure    EventType = "connection.secure"
+	EventConnectionStartOk   EventType = "connection.start-ok"
+	EventConnectionTuneOk    EventType = "connection.tune-ok"
+	EventConnectionOpen      EventType = "connection.open"
+	EventConnectionClose     EventType = "connection.close"
+	EventConnectionLost      EventType = "connection.lost"
+	EventConnectionError     EventType = "connection.error"
+	EventHeartbeatMissed     EventType = "connection.heartbeat-missed"
+	EventConnectionClosing   EventType = "connection.closing"
+	EventConnectionClosed    EventType = "connection.closed"
+	EventConnectionBlocked   EventType = "connection.blocked"
+	EventConnectionUnblocked EventType = "connection.unblocked"
+	EventChannelOpen         EventType = "channel.open"
+	EventChannelClose        EventType = "channel.close"
+	EventChannelClosing      EventType = "channel.closing"
+	EventChannelFlow         EventType = "channel.flow"
+	EventChannelFlowOk       EventType = "channel.flow-ok"
+	EventClientFlow          EventType = "channel.client-flow"
+	EventExchangeDeclare     EventType = "exchange.declare"
+	EventExchangeDelete      EventType = "exchange.delete"
+	EventQueueDeclare        EventType = "queue.declare"
+	EventQueueBind           EventType = "queue.bind"
+	EventQueueUnbind         EventType = "queue.unbind"
+	EventQueuePurge          EventType = "queue.purge"
+	EventQueueDelete         EventType = "queue.delete"
+	EventBasicConsume        EventType = "basic.consume"
+	EventBasicCancel         EventType = "basic.cancel"
+	EventBasicPublish        EventType = "basic.publish"
+	EventPublishWhileBlocked EventType = "basic.publish-while-blocked"
+	EventPublishWhilePaused  EventType = "basic.publish-while-paused"
+	EventMessage             EventType = "message"
+	EventInvalidFrame        EventType = "frame.invalid"
+	EventFrame               EventType = "frame.trace"
+)
+
+// Event is a single thing that happened on the server.
+// Fields that do not apply to the event are left empty.
+type Event struct {
+	Time       time.Time `json:"timestamp"`
+	Type       EventType `json:"event"`
+	Connection uint64    `json:"connection,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	User       string    `json:"user,omitempty"`
+	VHost      string    `json:"vhost,omitempty"`
+	Channel    uint16    `json:"channel,omitempty"`
+	Exchange   string    `json:"exchange,omitempty"`
+	// ExchangeType is set for declared exchanges
+	ExchangeType string `json:"exchange_type,omitempty"`
+	RoutingKey   string `json:"routing_key,omitempty"`
+	// Queue is set for queue events
+	Queue string `json:"queue,omitempty"`
+	// Queues are the queues a message was routed to
+	Queues []string `json:"queues,omitempty"`
+	// ConsumerTag is set for consumers subscribing or cancelling
+	ConsumerTag string `json:"consumer_tag,omitempty"`
+
+	// ReplyCode and ReplyText are set for connections and channels closed by either side
+	ReplyCode uint16 `json:"reply_code,omitempty"`
+	ReplyText string `json:"reply_text,omitempty"`
+
+	Properties *client.Properties `json:"properties,omitempty"`
+	// Content is the body of a published message exactly as it was received
+	Content []byte `json:"-"`
+	// Decoded is Content after undoing its content-encoding; nil if the body was not decoded
+	Decoded []byte `json:"-"`
+	// Size of the body as received and DecodedSize after undoing its content-encoding
+	Size        int `json:"size,omitempty"`
+	DecodedSize int `json:"decoded_size,omitempty"`
+	// Body is set for bodies that are valid UTF-8, BodyBase64 for all others.
+	// Both hold the decoded body if it could be decoded.
+	Body       string `json:"body,omitempty"`
+	BodyBase64 string `json:"body_base64,omitempty"`
+	// Protobuf is the body decoded to JSON if it is a known protobuf message
+	Protobuf json.RawMessage `json:"protobuf,omitempty"`
+
+	// Direction is capture.Inbound or capture.Outbound for traced frames, Frame their bytes
+	Direction string `json:"direction,omitempty"`
+	Frame     []byte `json:"frame,omitempty"`
+
+	// Message is the log line printed for the event in text format
+	Message string `json:"message"`
+}
+
+// setBody stores `body` in the field that keeps it intact in JSON
+func (e *Event) setBody(body []byte) {
+	if utf8.Valid(body) {
+		e.Body = string(body)
+	} else {
+		e.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+}
+
+// Subscribe returns a channel receiving every event from now on until `cancel` is called.
+// Events are dropped for subscribers that fall behind by more than `buffer` events.
+func (s *Server) Subscribe(buffer int) (events <-chan Event, cancel func()) {
+	ch := make(chan Event, buffer)
+
+	s.subsMu.Lock()
+	if s.subs == nil {
+		s.subs = make(map[chan Event]struct{})
+	}
+	s.subs[ch] = struct{}{}
+	s.subsMu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.subsMu.Lock()
+			delete(s.subs, ch)
+			s.subsMu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// recentMessages is the number of received messages kept for RecentMessages
+const recentMessages = 100
+
+// remember keeps `event` of a received message, dropping the oldest beyond recentMessages
+func (s *Server) remember(event Event) {
+	s.recentMu.Lock()
+	defer s.recentMu.Unlock()
+
+	s.recent = append(s.recent, event)
+	if len(s.recent) > recentMessages {
+		s.recent = s.recent[len(s.recent)-recentMessages:]
+	}
+}
+
+// RecentMessages returns the events of the last messages received, oldest first
+func (s *Server) RecentMessages() []Event {
+	s.recentMu.Lock()
+	defer s.recentMu.Unlock()
+
+	return append([]Event(nil), s.recent...)
+}
+
+// emit logs `event` which happened on `conn`, or on the server if `conn` is nil, and passes it to all subscribers.
+// The text format prints `format` just like Printf.
+func (s *Server) emit(conn *connection, event Event, format string, v ...any) {
+	event.Time = time.Now()
+	event.Message = fmt.Sprintf(format, v...)
+	if conn != nil {
+		event.Connection = conn.id
+		event.RemoteAddr = conn.RemoteAddr().String()
+		conn.mu.Lock()
+		if event.User == "" { // the user logging in is known before the login succeeded
+			event.User = conn.user
+		}
+		event.VHost = conn.vhost
+		conn.mu.Unlock()
+	}
+
+	if event.Type == EventMessage {
+		s.remember(event)
+	}
+
+	s.subsMu.Lock()
+	for sub := range s.subs {
+		select {
+		case sub <- event:
+		default:
+		}
+	}
+	s.subsMu.Unlock()
+
+	if !s.Filter.Allows(&event) {
+		return
+	}
+
+	switch {
+	case s.Handler != nil:
+		s.logAttrs(event)
+		return
+	case s.Format != FormatJSON:
+		s.Log.Printf("%s\n", s.text(&event))
+		return
+	}
+
+	s.Log.Printf("%s\n", marshalEvent(event))
+}
+
+// marshalEvent encodes `event` as JSON, leaving out properties that cannot be encoded
+func marshalEvent(event Event) []byte {
+	line, err := json.Marshal(event)
+	if err != nil { // only unsupported header values can fail
+		event.Properties = nil
+		event.Message = fmt.Sprintf("%v (properties could not be encoded: %v)", event.Message, err)
+		line, _ = json.Marshal(event)
+	}
+
+	return line
+}
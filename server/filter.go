@@ -0,0 +1,130 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/resamvi/amqparrot/amqp"
+)
+
+// Filter selects the events that are logged; subscribers still receive all events.
+// Each condition only applies to events that carry the attribute it checks, e.g. the
+// exchange conditions do not hide connection events. Messages and their basic.publish always carry
+// an exchange and routing key, the default exchange is matched by "" and amq.default.
+// Empty conditions match everything.
+type Filter struct {
+	// Exchanges to log exclusively, ExcludeExchanges to hide
+	Exchanges        []string
+	ExcludeExchanges []string
+
+	// RoutingKeys are topic patterns like `order.*` or `#.eu`
+	RoutingKeys        []string
+	ExcludeRoutingKeys []string
+
+	VHosts        []string
+	ExcludeVHosts []string
+
+	Users        []string
+	ExcludeUsers []string
+
+	// Headers maps header names to the values messages and their basic.publish may carry, one of which must match.
+	// An empty value only requires the header to be present.
+	Headers        map[string][]string
+	ExcludeHeaders map[string][]string
+
+	// NoChatter hides connection and channel events unless they report a problem
+	NoChatter bool
+}
+
+// Allows reports whether `event` is logged
+func (f *Filter) Allows(event *Event) bool {
+	if f.NoChatter && isChatter(event.Type) {
+		return false
+	}
+
+	published := isPublished(event.Type)
+
+	return matches(event.Exchange, published, f.Exchanges, f.ExcludeExchanges, sameExchange) &&
+		matches(event.RoutingKey, published, f.RoutingKeys, f.ExcludeRoutingKeys, amqp.MatchTopic) &&
+		matches(event.VHost, false, f.VHosts, f.ExcludeVHosts, equal) &&
+		matches(event.User, false, f.Users, f.ExcludeUsers, equal) &&
+		(!published || matchesHeaders(event, f.Headers, f.ExcludeHeaders))
+}
+
+func equal(a, b string) bool { return a == b }
+
+// sameExchange is equal, but also matches the default exchange by its name in the management API
+func sameExchange(pattern, name string) bool {
+	return pattern == name || pattern == "amq.default" && name == ""
+}
+
+// isPublished reports whether events of type `typ` are about a published message
+func isPublished(typ EventType) bool {
+	return typ == EventMessage || typ == EventBasicPublish
+}
+
+// matches checks `value` against the include and exclude lists.
+// Empty values are not filtered unless `present`, which means the event always carries the value.
+func matches(value string, present bool, include, exclude []string, match func(pattern, value string) bool) bool {
+	if value == "" && !present {
+		return true
+	}
+
+	for _, pattern := range exclude {
+		if match(pattern, value) {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, pattern := range include {
+		if match(pattern, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesHeaders checks the headers of a published message
+func matchesHeaders(event *Event, include, exclude map[string][]string) bool {
+	var headers map[string]any
+	if event.Properties != nil {
+		headers = event.Properties.Headers
+	}
+	has := func(name string, values []string) bool {
+		v, ok := headers[name]
+		if !ok {
+			return false
+		}
+		for _, value := range values {
+			if value == "" || fmt.Sprint(v) == value {
+				return true
+			}
+		}
+		return false
+	}
+
+	for name, values := range exclude {
+		if has(name, values) {
+			return false
+		}
+	}
+	for name, values := range include {
+		if !has(name, values) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isChatter reports whether events of type `typ` only tell about the usual lifecycle of connections and channels
+func isChatter(typ EventType) bool {
+	name := string(typ)
+	lifecycle := strings.HasPrefix(name, "connection.") || strings.HasPrefix(name, "channel.")
+
+	return lifecycle && eventLevel(typ) < slog.LevelWarn
+}
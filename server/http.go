@@ -0,0 +1,264 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/resamvi/amqparrot/amqp/client"
+)
+
+// serveHTTP runs the HTTP API on s.HTTPAddr
+func (s *Server) serveHTTP() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/connections", s.httpConnections)
+	mux.HandleFunc("/connections/", s.httpConnection)
+	mux.HandleFunc("/channels", s.httpList(func(string) any { return s.Channels() }))
+	mux.HandleFunc("/exchanges", s.httpList(func(vhost string) any { return nonNil(s.Exchanges(vhost)) }))
+	mux.HandleFunc("/queues", s.httpList(func(vhost string) any { return nonNil(s.Queues(vhost)) }))
+	mux.HandleFunc("/queues/", s.httpQueue)
+	mux.HandleFunc("/bindings", s.httpList(func(vhost string) any { return nonNil(s.Bindings(vhost)) }))
+	mux.HandleFunc("/messages", s.httpList(func(string) any { return nonNil(s.RecentMessages()) }))
+	mux.HandleFunc("/publish", s.httpPublish)
+	mux.HandleFunc("/metrics", s.httpMetrics)
+	mux.HandleFunc("/events", s.httpEvents)
+	mux.Handle("/ui/", webUI())
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, "/ui/", http.StatusFound)
+	})
+
+	// the management API bypasses the mux, which would redirect paths containing the escaped vhost "/"
+	handler := s.authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			s.httpManagement(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+
+	lstner, err := net.Listen("tcp", s.HTTPAddr)
+	if err != nil {
+		s.emit(nil, Event{Type: EventServerError}, HTTPFailed, err)
+		return
+	}
+	s.mu.Lock()
+	s.apiAddr = lstner.Addr()
+	s.mu.Unlock()
+
+	s.emit(nil, Event{Type: EventStarted}, HTTPStarted, lstner.Addr())
+	if err := http.Serve(lstner, handler); err != nil {
+		s.emit(nil, Event{Type: EventServerError}, HTTPFailed, err)
+	}
+}
+
+// authorize requires requests to log in with basic auth as a user that may use the HTTP API,
+// unless the server accepts every login
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		acc, ok := s.login(user, pass, false)
+		reason := "Not_Authorized"
+		if ok && !acc.canManage() {
+			ok, reason = false, "Not management user"
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="amqparrot"`)
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				managementError(w, http.StatusUnauthorized, reason)
+			} else {
+				http.Error(w, reason, http.StatusUnauthorized)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// httpConnections lists all open connections
+//
+//	GET /connections
+func (s *Server) httpConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, s.Connections())
+}
+
+// httpList lists what `list` returns for the vhost given as query parameter, or for all vhosts
+//
+//	GET /channels
+//	GET /exchanges?vhost=...
+//	GET /queues?vhost=...
+//	GET /bindings?vhost=...
+//	GET /messages
+func (s *Server) httpList(list func(vhost string) any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		writeJSON(w, list(r.URL.Query().Get("vhost")))
+	}
+}
+
+// httpConnection closes a connection or triggers flow control on it
+//
+//	DELETE /connections/{id}?reason=...
+//	POST /connections/{id}/block?reason=...
+//	POST /connections/{id}/unblock
+//	POST /connections/{id}/channels/{channel}/flow?active=false
+func (s *Server) httpConnection(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/connections/"), "/")
+	if r.Method != http.MethodPost && (r.Method != http.MethodDelete || len(parts) != 1) {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid connection id", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		reason := r.URL.Query().Get("reason")
+		if reason == "" {
+			reason = "Closed via HTTP API"
+		}
+		err = s.CloseConnection(id, reason)
+
+	case len(parts) == 2 && parts[1] == "block":
+		reason := r.URL.Query().Get("reason")
+		if reason == "" {
+			reason = "low on memory"
+		}
+		err = s.Block(id, reason)
+
+	case len(parts) == 2 && parts[1] == "unblock":
+		err = s.Unblock(id)
+
+	case len(parts) == 4 && parts[1] == "channels" && parts[3] == "flow":
+		channel, perr := strconv.ParseUint(parts[2], 10, 16)
+		if perr != nil {
+			http.Error(w, "invalid channel id", http.StatusBadRequest)
+			return
+		}
+		active, perr := strconv.ParseBool(r.URL.Query().Get("active"))
+		if perr != nil {
+			http.Error(w, "active must be true or false", http.StatusBadRequest)
+			return
+		}
+		err = s.Flow(id, uint16(channel), active)
+
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case errors.Is(err, ErrUnknownConnection), errors.Is(err, ErrUnknownChannel):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrNotBlockable):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// httpQueue purges a queue
+//
+//	POST /queues/{name}/purge?vhost=...
+func (s *Server) httpQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/queues/"), "/purge")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	purged, err := s.PurgeQueue(vhostParam(r), name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, map[string]int{"message_count": purged})
+}
+
+// httpPublish handles a message as if a client had published it.
+// The body is given as UTF-8 text in body, or in body_base64.
+//
+//	POST /publish {"vhost": "/", "exchange": "...", "routing_key": "...", "properties": {...}, "body": "..."}
+func (s *Server) httpPublish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var msg struct {
+		VHost      string            `json:"vhost"`
+		Exchange   string            `json:"exchange"`
+		RoutingKey string            `json:"routing_key"`
+		Properties client.Properties `json:"properties"`
+		Body       string            `json:"body"`
+		BodyBase64 []byte            `json:"body_base64"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, "invalid message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg.VHost == "" {
+		msg.VHost = "/"
+	}
+	body := msg.BodyBase64
+	if body == nil {
+		body = []byte(msg.Body)
+	}
+
+	if err := s.Publish(msg.VHost, msg.Exchange, msg.RoutingKey, msg.Properties, body); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// vhostParam returns the vhost query parameter, which defaults to "/"
+func vhostParam(r *http.Request) string {
+	if vhost := r.URL.Query().Get("vhost"); vhost != "" {
+		return vhost
+	}
+
+	return "/"
+}
+
+// nonNil turns nil slices into empty ones so they are encoded as [] instead of null
+func nonNil[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+
+	return list
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,475 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/resamvi/amqparrot/amqp"
+)
+
+// managementQueue is a queue as the RabbitMQ management API shows it
+type managementQueue struct {
+	QueueInfo
+	MessagesReady          int    `json:"messages_ready"`
+	MessagesUnacknowledged int    `json:"messages_unacknowledged"`
+	State                  string `json:"state"`
+	Type                   string `json:"type"`
+	Node                   string `json:"node"`
+}
+
+// managementBinding is a binding as the RabbitMQ management API shows it
+type managementBinding struct {
+	BindingInfo
+	// PropertiesKey identifies the binding among those with the same source and destination
+	PropertiesKey string `json:"properties_key"`
+}
+
+// node is the name amqparrot reports as RabbitMQ node and cluster
+const node = "amqparrot@localhost"
+
+// httpManagement emulates the part of the RabbitMQ management API that tools use to inspect and set up a broker.
+// Path segments are unescaped individually since the default vhost "/" is passed as %2F.
+//
+//	GET /api/overview
+//	GET /api/vhosts, GET, PUT /api/vhosts/{vhost}
+//	GET /api/exchanges[/{vhost}], GET, PUT, DELETE /api/exchanges/{vhost}/{name}
+//	GET /api/queues[/{vhost}], GET, PUT, DELETE /api/queues/{vhost}/{name}
+//	DELETE /api/queues/{vhost}/{name}/contents
+//	GET /api/bindings[/{vhost}]
+//	GET, POST /api/bindings/{vhost}/e/{exchange}/q/{queue} and .../e/{exchange}/e/{exchange}
+//	GET, DELETE /api/bindings/{vhost}/e/{exchange}/q/{queue}/{properties_key}
+//	GET, POST /api/definitions
+func (s *Server) httpManagement(w http.ResponseWriter, r *http.Request) {
+	var path []string
+	for _, segment := range strings.Split(strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), "/api/"), "/"), "/") {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			managementError(w, http.StatusBadRequest, "invalid path")
+			return
+		}
+		path = append(path, unescaped)
+	}
+
+	switch path[0] {
+	case "overview":
+		s.managementOverview(w, r)
+	case "vhosts":
+		s.managementVHosts(w, r, path[1:])
+	case "exchanges":
+		s.managementExchanges(w, r, path[1:])
+	case "queues":
+		s.managementQueues(w, r, path[1:])
+	case "bindings":
+		s.managementBindings(w, r, path[1:])
+	case "definitions":
+		s.managementDefinitions(w, r)
+	default:
+		managementError(w, http.StatusNotFound, "Object Not Found")
+	}
+}
+
+func (s *Server) managementOverview(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	messages, consumers := 0, 0
+	queues := s.Queues("")
+	for _, q := range queues {
+		messages += q.Messages
+		consumers += q.Consumers
+	}
+
+	writeJSON(w, map[string]any{
+		"management_version": rabbitVersion,
+		"rabbitmq_version":   rabbitVersion,
+		"product_name":       "amqparrot",
+		"product_version":    "1.0.0",
+		"cluster_name":       node,
+		"node":               node,
+		"object_totals": map[string]int{
+			"connections": len(s.Connections()),
+			"channels":    len(s.Channels()),
+			"exchanges":   len(s.Exchanges("")),
+			"queues":      len(queues),
+			"consumers":   consumers,
+		},
+		"queue_totals": map[string]int{
+			"messages":                messages,
+			"messages_ready":          messages,
+			"messages_unacknowledged": 0,
+		},
+	})
+}
+
+func (s *Server) managementVHosts(w http.ResponseWriter, r *http.Request, path []string) {
+	switch len(path) {
+	case 0:
+		if !allowMethods(w, r, http.MethodGet) {
+			return
+		}
+		vhosts := make([]VHostDefinition, 0)
+		for _, name := range s.VHosts() {
+			vhosts = append(vhosts, VHostDefinition{Name: name})
+		}
+		writeJSON(w, vhosts)
+
+	case 1:
+		if !allowMethods(w, r, http.MethodGet, http.MethodPut) {
+			return
+		}
+		exists := s.hasVHost(path[0])
+		switch {
+		case r.Method == http.MethodPut && exists:
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPut:
+			s.AddVHost(path[0])
+			w.WriteHeader(http.StatusCreated)
+		case exists:
+			writeJSON(w, VHostDefinition{Name: path[0]})
+		default:
+			managementError(w, http.StatusNotFound, "Object Not Found")
+		}
+
+	default:
+		managementError(w, http.StatusNotFound, "Object Not Found")
+	}
+}
+
+func (s *Server) managementExchanges(w http.ResponseWriter, r *http.Request, path []string) {
+	if len(path) > 0 && !s.hasVHost(path[0]) {
+		managementError(w, http.StatusNotFound, "Object Not Found")
+		return
+	}
+
+	switch len(path) {
+	case 0, 1:
+		if !allowMethods(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, nonNil(s.Exchanges(strings.Join(path, ""))))
+
+	case 2:
+		if !allowMethods(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+			return
+		}
+		vhost, name := path[0], defaultExchange(path[1])
+		existing := s.findExchange(vhost, name)
+
+		switch r.Method {
+		case http.MethodGet:
+			if existing != nil {
+				writeJSON(w, existing)
+			} else {
+				managementError(w, http.StatusNotFound, "Object Not Found")
+			}
+		case http.MethodPut:
+			e := ExchangeInfo{Durable: true}
+			if err := json.NewDecoder(r.Body).Decode(&e); err != nil || e.Type == "" {
+				managementError(w, http.StatusBadRequest, "exchange type missing or invalid body")
+				return
+			}
+			e.VHost, e.Name = vhost, name
+			if err := s.declareExchange(e, false); err != nil {
+				managementError(w, brokerStatus(err), err.Error())
+				return
+			}
+			created(w, existing != nil)
+		case http.MethodDelete:
+			if err := s.deleteExchange(vhost, name, r.URL.Query().Get("if-unused") == "true"); err != nil {
+				managementError(w, brokerStatus(err), err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+
+	default:
+		managementError(w, http.StatusNotFound, "Object Not Found")
+	}
+}
+
+func (s *Server) managementQueues(w http.ResponseWriter, r *http.Request, path []string) {
+	if len(path) > 0 && !s.hasVHost(path[0]) {
+		managementError(w, http.StatusNotFound, "Object Not Found")
+		return
+	}
+
+	switch {
+	case len(path) <= 1:
+		if !allowMethods(w, r, http.MethodGet) {
+			return
+		}
+		queues := make([]managementQueue, 0)
+		for _, q := range s.Queues(strings.Join(path, "")) {
+			queues = append(queues, newManagementQueue(q))
+		}
+		writeJSON(w, queues)
+
+	case len(path) == 2:
+		if !allowMethods(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+			return
+		}
+		vhost, name := path[0], path[1]
+		q := s.findQueue(vhost, name)
+
+		switch r.Method {
+		case http.MethodGet:
+			if q != nil {
+				writeJSON(w, newManagementQueue(*q))
+			} else {
+				managementError(w, http.StatusNotFound, "Object Not Found")
+			}
+		case http.MethodPut:
+			declared := QueueInfo{Durable: true}
+			if err := json.NewDecoder(r.Body).Decode(&declared); err != nil {
+				managementError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+				return
+			}
+			declared.VHost, declared.Name, declared.Exclusive, declared.Messages, declared.Consumers = vhost, name, false, 0, 0
+			if err := reservedQueue(name); err != nil {
+				managementError(w, brokerStatus(err), err.Error())
+				return
+			}
+			if _, err := s.declareQueue(declared, false); err != nil {
+				managementError(w, brokerStatus(err), err.Error())
+				return
+			}
+			created(w, q != nil)
+		case http.MethodDelete:
+			if _, err := s.deleteQueue(vhost, name, r.URL.Query().Get("if-unused") == "true", r.URL.Query().Get("if-empty") == "true"); err != nil {
+				managementError(w, brokerStatus(err), err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+
+	case len(path) == 3 && path[2] == "contents":
+		if !allowMethods(w, r, http.MethodDelete) {
+			return
+		}
+		if _, err := s.PurgeQueue(path[0], path[1]); err != nil {
+			managementError(w, brokerStatus(err), err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		managementError(w, http.StatusNotFound, "Object Not Found")
+	}
+}
+
+func (s *Server) managementBindings(w http.ResponseWriter, r *http.Request, path []string) {
+	if len(path) > 0 && !s.hasVHost(path[0]) {
+		managementError(w, http.StatusNotFound, "Object Not Found")
+		return
+	}
+
+	if len(path) <= 1 {
+		if !allowMethods(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, managementBindings(s.Bindings(strings.Join(path, "")), nil))
+		return
+	}
+
+	// /api/bindings/{vhost}/e/{source}/{q|e}/{destination}[/{properties_key}]
+	if (len(path) != 5 && len(path) != 6) || path[1] != "e" || (path[3] != "q" && path[3] != "e") {
+		managementError(w, http.StatusNotFound, "Object Not Found")
+		return
+	}
+	b := BindingInfo{VHost: path[0], Source: defaultExchange(path[2]), Destination: path[4], DestinationType: DestinationQueue}
+	if path[3] == "e" {
+		b.DestinationType = DestinationExchange
+	}
+	between := func(other BindingInfo) bool {
+		return other.Source == b.Source && other.Destination == b.Destination && other.DestinationType == b.DestinationType
+	}
+
+	if len(path) == 6 {
+		if !allowMethods(w, r, http.MethodGet, http.MethodDelete) {
+			return
+		}
+		matching := managementBindings(s.Bindings(b.VHost), func(other BindingInfo) bool {
+			return between(other) && propertiesKey(other) == path[5]
+		})
+		switch {
+		case len(matching) == 0:
+			managementError(w, http.StatusNotFound, "Object Not Found")
+		case r.Method == http.MethodGet:
+			writeJSON(w, matching[0])
+		default:
+			if err := s.unbind(matching[0].BindingInfo); err != nil {
+				managementError(w, brokerStatus(err), err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+
+	if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+	if r.Method == http.MethodGet {
+		writeJSON(w, managementBindings(s.Bindings(b.VHost), between))
+		return
+	}
+
+	var body struct {
+		RoutingKey string         `json:"routing_key"`
+		Arguments  map[string]any `json:"arguments"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		managementError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	b.RoutingKey, b.Arguments = body.RoutingKey, body.Arguments
+	if err := s.bind(b); err != nil {
+		managementError(w, brokerStatus(err), err.Error())
+		return
+	}
+	w.Header().Set("Location", url.PathEscape(propertiesKey(b)))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) managementDefinitions(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+	if r.Method == http.MethodGet {
+		writeJSON(w, s.Definitions())
+		return
+	}
+
+	var d Definitions
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		managementError(w, http.StatusBadRequest, "invalid definitions: "+err.Error())
+		return
+	}
+	if err := s.ImportDefinitions(d); err != nil {
+		managementError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findExchange returns a copy of the exchange `name` in `vhost`, or nil if it does not exist
+func (s *Server) findExchange(vhost, name string) *ExchangeInfo {
+	s.brokerMu.Lock()
+	defer s.brokerMu.Unlock()
+
+	if v, ok := s.vhosts[vhost]; ok {
+		if e, ok := v.exchanges[name]; ok {
+			found := *e
+			return &found
+		}
+	}
+
+	return nil
+}
+
+// findQueue returns a copy of the queue `name` in `vhost`, or nil if it does not exist
+func (s *Server) findQueue(vhost, name string) *QueueInfo {
+	s.brokerMu.Lock()
+	defer s.brokerMu.Unlock()
+
+	if v, ok := s.vhosts[vhost]; ok {
+		if q, ok := v.queues[name]; ok {
+			found := *q
+			return &found
+		}
+	}
+
+	return nil
+}
+
+// defaultExchange maps amq.default, the name of the default exchange in URLs, to its actual name
+func defaultExchange(name string) string {
+	if name == "amq.default" {
+		return ""
+	}
+
+	return name
+}
+
+func newManagementQueue(q QueueInfo) managementQueue {
+	return managementQueue{QueueInfo: q, MessagesReady: q.Messages, State: "running", Type: "classic", Node: node}
+}
+
+// managementBindings converts the bindings `keep` accepts, or all if it is nil
+func managementBindings(bindings []BindingInfo, keep func(BindingInfo) bool) []managementBinding {
+	converted := make([]managementBinding, 0, len(bindings))
+	for _, b := range bindings {
+		if keep == nil || keep(b) {
+			converted = append(converted, managementBinding{BindingInfo: b, PropertiesKey: propertiesKey(b)})
+		}
+	}
+
+	return converted
+}
+
+// propertiesKey identifies a binding like RabbitMQ does: its routing key, followed by a hash of its arguments if any
+func propertiesKey(b BindingInfo) string {
+	if len(b.Arguments) == 0 {
+		if b.RoutingKey == "" {
+			return "~"
+		}
+		return b.RoutingKey
+	}
+
+	hash := sha256.Sum256([]byte(fmt.Sprint(b.Arguments)))
+	return b.RoutingKey + "~" + base64.RawURLEncoding.EncodeToString(hash[:6])
+}
+
+// brokerStatus is the HTTP status of a failed exchange or queue operation
+func brokerStatus(err error) int {
+	var failed *brokerError
+	switch {
+	case !errors.As(err, &failed):
+		return http.StatusBadRequest
+	case failed.code == amqp.NotFound:
+		return http.StatusNotFound
+	case failed.code == amqp.AccessRefused:
+		return http.StatusForbidden
+	}
+
+	return http.StatusBadRequest
+}
+
+// allowMethods answers 405 unless the request uses one of `methods`
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	managementError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+
+	return false
+}
+
+// created answers a PUT with 201 if it created something, 204 if it already existed
+func created(w http.ResponseWriter, existed bool) {
+	if existed {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// managementError answers with an error in the format of the RabbitMQ management API
+func managementError(w http.ResponseWriter, status int, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":  strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_")),
+		"reason": reason,
+	})
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/resamvi/amqparrot/amqp"
+	"github.com/resamvi/amqparrot/capture"
+)
+
+// metrics counts the traffic of all connections for the Prometheus endpoint
+type metrics struct {
+	mu                sync.Mutex
+	connectionsOpened uint64
+	receivedBytes     uint64
+	invalidFrames     uint64
+	// frames and methods are counted by direction and frame type or method name
+	frames  map[[2]string]uint64
+	methods map[[2]string]uint64
+	// published messages and their body bytes are counted by vhost and exchange
+	published      map[[2]string]uint64
+	publishedBytes map[[2]string]uint64
+}
+
+// frameTypes names frame types in metrics
+var frameTypes = map[uint8]string{
+	amqp.TypeMethod:    "method",
+	amqp.TypeHeader:    "header",
+	amqp.TypeBody:      "body",
+	amqp.TypeHeartbeat: "heartbeat",
+}
+
+// frame counts a frame read from or written to a client
+func (m *metrics) frame(direction string, frame []byte) {
+	typ, method := "protocol-header", ""
+	if !bytes.HasPrefix(frame, []byte("AMQP")) && len(frame) > 0 {
+		var ok bool
+		if typ, ok = frameTypes[frame[0]]; !ok {
+			typ = "unknown"
+		}
+		if frame[0] == amqp.TypeMethod && len(frame) >= amqp.FrameHeaderSize+4 {
+			payload := frame[amqp.FrameHeaderSize:]
+			method = amqp.MethodName(binary.BigEndian.Uint16(payload), binary.BigEndian.Uint16(payload[2:]))
+			if strings.HasPrefix(method, "unknown") { // one label for all, clients decide the class and method ids
+				method = "unknown"
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.frames == nil {
+		m.frames = make(map[[2]string]uint64)
+		m.methods = make(map[[2]string]uint64)
+	}
+	m.frames[[2]string{direction, typ}]++
+	if method != "" {
+		m.methods[[2]string{direction, method}]++
+	}
+	if direction == capture.Inbound {
+		m.receivedBytes += uint64(len(frame))
+	}
+}
+
+// message counts a message published to `exchange` in `vhost`
+func (m *metrics) message(vhost, exchange string, size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.published == nil {
+		m.published = make(map[[2]string]uint64)
+		m.publishedBytes = make(map[[2]string]uint64)
+	}
+	key := [2]string{vhost, exchange}
+	m.published[key]++
+	m.publishedBytes[key] += uint64(size)
+}
+
+func (m *metrics) connectionOpened() {
+	m.mu.Lock()
+	m.connectionsOpened++
+	m.mu.Unlock()
+}
+
+func (m *metrics) invalidFrame() {
+	m.mu.Lock()
+	m.invalidFrames++
+	m.mu.Unlock()
+}
+
+// httpMetrics serves all metrics in the Prometheus text format
+//
+//	GET /metrics
+func (s *Server) httpMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.writeMetrics(w)
+}
+
+func (s *Server) writeMetrics(w io.Writer) {
+	conns := s.Connections()
+	channels := 0
+	for _, c := range conns {
+		channels += len(c.Channels)
+	}
+	queues := s.Queues("")
+
+	m := &s.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := &exposition{w: w}
+	p.metric("amqparrot_connections", "gauge", "Open client connections.")
+	p.sample(nil, uint64(len(conns)))
+	p.metric("amqparrot_connections_opened_total", "counter", "Client connections accepted since start.")
+	p.sample(nil, m.connectionsOpened)
+	p.metric("amqparrot_channels", "gauge", "Open channels of all connections.")
+	p.sample(nil, uint64(channels))
+
+	p.metric("amqparrot_frames_total", "counter", "Frames read from and written to clients by direction and type.")
+	p.samples(m.frames, "direction", "type")
+	p.metric("amqparrot_methods_total", "counter", "Methods read from and written to clients by direction and name.")
+	p.samples(m.methods, "direction", "method")
+	p.metric("amqparrot_received_bytes_total", "counter", "Bytes of all frames read from clients.")
+	p.sample(nil, m.receivedBytes)
+	p.metric("amqparrot_invalid_frames_total", "counter", "Frames that could not be parsed or violated the protocol.")
+	p.sample(nil, m.invalidFrames)
+
+	p.metric("amqparrot_messages_published_total", "counter", "Messages published by vhost and exchange.")
+	p.samples(m.published, "vhost", "exchange")
+	p.metric("amqparrot_messages_published_bytes_total", "counter", "Body bytes of published messages by vhost and exchange.")
+	p.samples(m.publishedBytes, "vhost", "exchange")
+
+	p.metric("amqparrot_queue_messages", "gauge", "Messages in each queue.")
+	for _, q := range queues {
+		p.sample([]string{"vhost", q.VHost, "queue", q.Name}, uint64(q.Messages))
+	}
+}
+
+// exposition writes metrics in the Prometheus text format
+type exposition struct {
+	w    io.Writer
+	name string
+}
+
+func (p *exposition) metric(name, typ, help string) {
+	p.name = name
+	fmt.Fprintf(p.w, "# HELP %v %v\n# TYPE %v %v\n", name, help, name, typ)
+}
+
+// sample writes a sample of the current metric with labels given as name, value pairs
+func (p *exposition) sample(labels []string, value uint64) {
+	if len(labels) == 0 {
+		fmt.Fprintf(p.w, "%v %v\n", p.name, value)
+		return
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%v="%v"`, labels[i], labelEscaper.Replace(labels[i+1])))
+	}
+	fmt.Fprintf(p.w, "%v{%v} %v\n", p.name, strings.Join(pairs, ","), value)
+}
+
+// samples writes the counters of `values` in order, labeled with the two parts of their key
+func (p *exposition) samples(values map[[2]string]uint64, first, second string) {
+	keys := make([][2]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1]
+	})
+
+	for _, key := range keys {
+		p.sample([]string{first, key[0], second, key[1]}, values[key])
+	}
+}
+
+// labelEscaper escapes label values, which unlike Go strings keep non-ASCII runes as UTF-8
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+)
+
+// Widths of the columns of Pretty output; longer values push the rest of their line to the right
+const (
+	typeWidth       = 22
+	originWidth     = 7
+	exchangeWidth   = 16
+	routingKeyWidth = 20
+)
+
+// bodyIndent precedes every line of bodies and hex dumps in Pretty output
+const bodyIndent = "    "
+
+// ANSI escape sequences coloring Pretty output
+const (
+	colorReset   = "\x1b[0m"
+	colorBold    = "\x1b[1m"
+	colorDim     = "\x1b[2m"
+	colorRed     = "\x1b[1;31m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorBlue    = "\x1b[34m"
+	colorMagenta = "\x1b[35m"
+	colorCyan    = "\x1b[36m"
+)
+
+// text returns the log line of `event` in text format
+func (s *Server) text(event *Event) string {
+	line := event.Message
+	if event.Type == EventMessage && s.BodyLimit > 0 {
+		if summary, body, ok := strings.Cut(line, "\n"); ok {
+			line = summary + "\n" + truncate(body, s.BodyLimit)
+		}
+	}
+
+	if s.Pretty {
+		return s.pretty(event, line)
+	}
+	return line
+}
+
+// pretty lays out `line` of `event` in columns, indenting the lines after the first
+func (s *Server) pretty(event *Event, line string) string {
+	summary, rest, multiline := strings.Cut(line, "\n")
+
+	origin := ""
+	if event.Connection != 0 {
+		origin = fmt.Sprintf("#%v", event.Connection)
+	}
+	if event.Channel != 0 {
+		origin += fmt.Sprintf("/%v", event.Channel)
+	}
+	label := pad(string(event.Type), typeWidth)
+	if s.Color {
+		label = eventColor(event.Type) + label + colorReset
+	}
+
+	var b strings.Builder
+	b.WriteString(event.Time.Format("15:04:05.000") + " " + label + " " + pad(origin, originWidth) + " ")
+	b.WriteString(pad(event.Exchange, exchangeWidth) + " " + pad(event.RoutingKey, routingKeyWidth) + " ")
+	b.WriteString(summary)
+	if multiline {
+		b.WriteString("\n" + bodyIndent + strings.ReplaceAll(rest, "\n", "\n"+bodyIndent))
+	}
+
+	return b.String()
+}
+
+// eventColor highlights problems by their level and all other events by what they concern
+func eventColor(typ EventType) string {
+	switch eventLevel(typ) {
+	case slog.LevelError:
+		return colorRed
+	case slog.LevelWarn:
+		return colorYellow
+	case slog.LevelDebug:
+		return colorDim
+	}
+
+	category, _, _ := strings.Cut(string(typ), ".")
+	switch category {
+	case "server":
+		return colorBold
+	case "connection":
+		return colorCyan
+	case "channel":
+		return colorBlue
+	case "exchange", "queue":
+		return colorMagenta
+	case "basic", "message":
+		return colorGreen
+	}
+
+	return ""
+}
+
+// pad fills `s` with spaces up to `width` characters
+func pad(s string, width int) string {
+	if n := utf8.RuneCountInString(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+// truncate cuts `body` off after `limit` characters, noting how many were left out
+func truncate(body string, limit int) string {
+	n := utf8.RuneCountInString(body)
+	if n <= limit {
+		return body
+	}
+
+	cut := 0
+	for i := 0; i < limit; i++ {
+		_, size := utf8.DecodeRuneInString(body[cut:])
+		cut += size
+	}
+	return fmt.Sprintf("%v… (%v more characters)", body[:cut], n-limit)
+}
@@ -2,18 +2,24 @@ package server
 
 import (
 	"bytes"
+	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"io"
 	"log"
+	"log/slog"
 	"net"
 	"os"
 	"strconv"
-	"syscall"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/resamvi/amqparrot/amqp"
 	"github.com/resamvi/amqparrot/amqp/client"
 	"github.com/resamvi/amqparrot/amqp/server"
+	"github.com/resamvi/amqparrot/capture"
+	"github.com/resamvi/amqparrot/content"
 )
 
 // Logger allows for inserting a custom logger with custom format
@@ -22,152 +28,868 @@ type Logger interface {
 }
 
 type Server struct {
-	// Port to listen for tcp connections.
+	// Port to listen for tcp connections. Port 0 picks a free port, see Addr.
 	Port int
 
 	// Log defines how the server prints its log messages
 	// Default: log.New(os.Stdout, "", log.LstdFlags)
 	Log Logger
+
+	// Heartbeat is the interval suggested to clients during connection tuning.
+	// Clients that stay silent for two intervals are disconnected.
+	// A negative value disables heartbeats.
+	// Default: 60s
+	Heartbeat time.Duration
+
+	// ChannelMax is the highest channel id clients may use.
+	// Clients can lower it during connection tuning.
+	// Default: 2047
+	ChannelMax uint16
+
+	// FrameMax is the largest frame in bytes clients may send.
+	// Clients can lower it during connection tuning.
+	// Default: 131072
+	FrameMax uint32
+
+	// TLSPort to listen for amqps connections. Disabled if 0.
+	TLSPort int
+
+	// TLSConfig for amqps connections. Clients may log in with the EXTERNAL
+	// mechanism if ClientAuth verifies their certificate; the common name is the user name.
+	TLSConfig *tls.Config
+
+	// Users that may log in along with their permissions per vhost.
+	// Every login is accepted and may do anything if nil.
+	Users []User
+
+	// Preload declares the vhosts, exchanges, queues and bindings of these definitions at startup.
+	// Their users are added to Users, replacing users of the same name.
+	Preload *Definitions
+
+	// Format of the log, either FormatText or FormatJSON.
+	// Default: FormatText
+	Format string
+
+	// Pretty lays out text in aligned columns with bodies indented below, meant for terminals.
+	// It prints its own timestamps, so Log should not add any.
+	Pretty bool
+
+	// Color highlights event types in Pretty output with ANSI escape sequences
+	Color bool
+
+	// BodyLimit cuts off bodies in text format after this many characters; 0 logs them whole
+	BodyLimit int
+
+	// RawBodies logs bodies exactly as received instead of rendering them by content type
+	RawBodies bool
+
+	// Record receives every complete message as received, regardless of Filter
+	Record *capture.Writer
+
+	// Frames receives every frame read from or written to clients, including protocol headers
+	Frames *capture.FrameWriter
+
+	// Trace logs every frame read from or written to clients, decoded and as hex dump
+	Trace bool
+
+	// Filter selects the events that are logged
+	Filter Filter
+
+	// Protobuf decodes bodies of the messages it has a mapping for to JSON
+	Protobuf *content.Protobuf
+
+	// Handler receives every event as a structured log record with the connection id,
+	// remote address, user, vhost and channel as attributes. Log and Format are ignored if set.
+	Handler slog.Handler
+
+	// HTTPAddr is the address of the HTTP API for inspecting and controlling the server, e.g. ":8081".
+	// The API is disabled if empty.
+	HTTPAddr string
+
+	// usersMu guards Users and accounts, which definitions imported at runtime change
+	usersMu  sync.Mutex
+	accounts map[string]*account
+
+	mu     sync.Mutex
+	nextID uint64
+	conns  map[uint64]*connection
+	// addr and apiAddr are where the server and its HTTP API listen once started
+	addr    net.Addr
+	apiAddr net.Addr
+
+	subsMu sync.Mutex
+	subs   map[chan Event]struct{}
+
+	brokerMu sync.Mutex
+	vhosts   map[string]*vhost
+
+	recentMu sync.Mutex
+	recent   []Event
+
+	metrics metrics
 }
 
+const (
+	defaultHeartbeat         = 60 * time.Second
+	defaultChannelMax uint16 = 2047
+	defaultFrameMax   uint32 = 131072
+)
+
 // Start the server
-func (s Server) Start() error {
+func (s *Server) Start() error {
 	if s.Log == nil {
 		s.Log = log.New(os.Stdout, "", 0)
 	}
+	if s.Heartbeat == 0 {
+		s.Heartbeat = defaultHeartbeat
+	}
+	if s.ChannelMax == 0 {
+		s.ChannelMax = defaultChannelMax
+	}
+	if s.FrameMax == 0 {
+		s.FrameMax = defaultFrameMax
+	}
+	if s.Format == "" {
+		s.Format = FormatText
+	}
+	if s.Format != FormatText && s.Format != FormatJSON {
+		return fmt.Errorf("unknown log format %q", s.Format)
+	}
+
+	s.conns = make(map[uint64]*connection)
+
+	s.Users = hashPasswords(s.Users)
+	accounts, err := compileUsers(s.Users)
+	if err != nil {
+		return fmt.Errorf("invalid users: %w", err)
+	}
+	s.accounts = accounts
+
+	s.AddVHost("/")
+	if s.Preload != nil {
+		if err := s.ImportDefinitions(*s.Preload); err != nil {
+			return fmt.Errorf("invalid definitions: %w", err)
+		}
+	}
 
 	lstner, err := net.Listen("tcp", ":"+strconv.Itoa(s.Port))
 	if err != nil {
 		return fmt.Errorf("could not start server: %w", err)
 	}
-	s.Log.Printf(Started, s.Port)
+	s.mu.Lock()
+	s.addr = lstner.Addr()
+	s.mu.Unlock()
+	s.emit(nil, Event{Type: EventStarted}, Started, lstner.Addr().(*net.TCPAddr).Port)
+
+	if s.TLSPort != 0 {
+		tlsLstner, err := tls.Listen("tcp", ":"+strconv.Itoa(s.TLSPort), s.TLSConfig)
+		if err != nil {
+			return fmt.Errorf("could not start TLS server: %w", err)
+		}
+		s.emit(nil, Event{Type: EventStarted}, StartedTLS, s.TLSPort)
+
+		go s.accept(tlsLstner)
+	}
+
+	if s.HTTPAddr != "" {
+		go s.serveHTTP()
+	}
+
+	s.accept(lstner)
+	return nil
+}
+
+// Addr returns the address the server accepts connections on, or nil until it listens
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addr
+}
+
+// APIAddr returns the address of the HTTP API, or nil until it listens
+func (s *Server) APIAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
+	return s.apiAddr
+}
+
+// accept serves every connection made to `lstner`
+func (s *Server) accept(lstner net.Listener) {
 	for {
 		conn, err := lstner.Accept()
 		if err != nil {
-			s.Log.Printf("Error accepting TCP connection: %v", err)
+			s.emit(nil, Event{Type: EventServerError}, AcceptFailed, err)
 			continue
 		}
-		s.Log.Printf("Serving %s\n", conn.RemoteAddr().String())
+		s.emit(nil, Event{Type: EventConnectionAccepted, RemoteAddr: conn.RemoteAddr().String()}, Serving, conn.RemoteAddr())
 
-		msgStream := Stream(conn)
-		go func() {
-			for msg := range msgStream {
-				s.handle(msg, conn)
-			}
-		}()
+		go s.serve(conn)
 	}
 }
 
-const (
-	lineEscape = "\n"
+// serve answers all messages received on `conn` until either side closes it
+func (s *Server) serve(conn net.Conn) {
+	s.mu.Lock()
+	s.nextID++
+	c := newConnection(s.nextID, conn, s.ChannelMax, s.FrameMax)
+	c.observe = func(direction string, frame []byte) {
+		s.metrics.frame(direction, frame)
+		if s.Frames != nil {
+			s.recordFrame(c, direction, frame)
+		}
+		if s.Trace {
+			s.trace(c, direction, frame)
+		}
+	}
+	s.conns[c.id] = c
+	s.mu.Unlock()
+	s.metrics.connectionOpened()
 
-	// All possible log lines server sends out
+	stream := c.readFrames()
 
-	Started = "Listening on port %v"
+	for in := range stream {
+		if c.discards(in) {
+			continue
+		}
+		if err := s.handle(in.message, c); err != nil {
+			s.emit(c, Event{Type: EventConnectionError}, ConnectionError, conn.RemoteAddr(), err)
+			break
+		}
+		if c.closed {
+			break
+		}
+	}
 
-	Hello = "hello received" + lineEscape
+	switch {
+	case c.closed, c.isClosing():
+	case errors.Is(c.readErr, os.ErrDeadlineExceeded):
+		s.emit(c, Event{Type: EventHeartbeatMissed}, HeartbeatMissed, conn.RemoteAddr(), missedHeartbeats)
+	default:
+		s.emit(c, Event{Type: EventConnectionLost}, ConnectionLost, conn.RemoteAddr())
+	}
+	for _, id := range c.openChannels() {
+		c.mu.Lock()
+		delete(c.channels, id)
+		c.mu.Unlock()
+		s.emit(c, Event{Type: EventChannelClose, Channel: id}, ChannelClose, id)
+	}
+	s.cancel(c.id, func(*consumer) bool { return true })
+	s.dropExclusive(c.id)
+	s.emit(c, Event{Type: EventConnectionClosed}, ConnectionClosed, conn.RemoteAddr())
 
-	ConnectionStartOk = "connection start ok with user \"%s\" and pass \"%s\" using mechanism \"%s\"" + lineEscape
-	ConnectionTuneOk  = "connection tune ok" + lineEscape
-	ConnectionOpen    = "Connection created in vhost '%v'" + lineEscape
+	s.mu.Lock()
+	delete(s.conns, c.id)
+	s.mu.Unlock()
 
-	ChannelOpen  = "Opened a Channel with id %v" + lineEscape
-	ChannelClose = "Closed a Channel with id %v" + lineEscape
+	close(c.done)
+	c.finish()
 
-	ExchangeDeclare = "Exchange '%v' of type '%v' declared" + lineEscape
+	// the reader stops once the client hung up or lingerTimeout passed; drain what it still had
+	for range stream {
+	}
+	conn.Close()
+}
 
-	BasicPublish = "Message to exchange '%v' with routing key '%v'" + lineEscape
-	BasicBody    = "Received body:\n%v" + lineEscape
+const (
+	// All possible log lines server sends out
+
+	Started      = "Listening on port %v"
+	StartedTLS   = "Listening for TLS on port %v"
+	AcceptFailed = "Error accepting TCP connection: %v"
+	Serving      = "Serving %v"
+	HTTPStarted  = "Control API listening on %v"
+	HTTPFailed   = "Control API stopped: %v"
+
+	Hello               = "hello received"
+	UnsupportedProtocol = "Client %v tried to speak %v, answered with AMQP 0-9-1 header and closed the connection"
+
+	ConnectionStartOk = "connection start ok with user \"%s\" using mechanism \"%s\""
+	ConnectionSecure  = "connection secure sent to challenge for %s credentials"
+	ConnectionTuneOk  = "connection tune ok with heartbeat of %vs"
+	ConnectionOpen    = "Connection created in vhost '%v'"
+	ConnectionClose   = "Connection closed by client with code %v: %v"
+	ConnectionLost    = "Connection to %v lost"
+	ConnectionError   = "Connection to %v failed: %v"
+	HeartbeatMissed   = "Connection to %v timed out after %v missed heartbeats"
+	ConnectionClosing = "Closing connection to %v with code %v: %v"
+	ConnectionClosed  = "Connection to %v closed"
+
+	ConnectionBlocked   = "Blocked connection to %v: %v"
+	ConnectionUnblocked = "Unblocked connection to %v"
+
+	ChannelOpen    = "Opened a Channel with id %v"
+	ChannelClose   = "Closed a Channel with id %v"
+	ChannelClosing = "Closing channel %v with code %v: %v"
+	ChannelFlow    = "Asked channel %v to set flow active=%v"
+	ChannelFlowOk  = "Channel %v confirmed flow active=%v"
+	ClientFlow     = "Channel %v asked to set flow active=%v"
+
+	ExchangeDeclare = "Exchange '%v' of type '%v' declared"
+	ExchangeDelete  = "Exchange '%v' deleted"
+
+	QueueDeclare = "Queue '%v' declared"
+	QueueBind    = "Queue '%v' bound to exchange '%v' with routing key '%v'"
+	QueueUnbind  = "Queue '%v' unbound from exchange '%v' with routing key '%v'"
+	QueuePurge   = "Queue '%v' purged, %v messages dropped"
+	QueueDelete  = "Queue '%v' deleted with %v messages"
+
+	BasicConsume = "Consumer '%v' subscribed to queue '%v'"
+	BasicCancel  = "Consumer '%v' cancelled"
+	BasicPublish = "Message to exchange '%v' with routing key '%v'"
+	BasicBody    = "Received body:\n%v"
+
+	BasicBodyDecoded     = "Received %v body of %v bytes, %v bytes decoded:\n%v"
+	BasicBodyUndecodable = "Received body with content-encoding '%v' that could not be decoded (%v):\n%v"
+
+	PublishWhileBlocked = "Message published on blocked connection to %v"
+	PublishWhilePaused  = "Message published on channel %v while its flow is paused"
+
+	InvalidFrame = "Invalid frame: %v"
+	RecordFailed = "Could not record message: %v"
+
+	FrameRead    = "Read %v\n%v"
+	FrameWritten = "Wrote %v\n%v"
 )
 
 // handle sends answers to `message` on the provided `conn`
-func (s Server) handle(message client.Message, conn net.Conn) {
+func (s *Server) handle(message client.Message, conn *connection) error {
+	if conn.isClosing() {
+		return s.handleClosing(message, conn)
+	}
+
 	var err error
 
 	switch msg := message.(type) {
 	// connection
 	case client.Hello:
-		s.Log.Printf(Hello)
-		_, err = conn.Write(server.ConnectionStart)
+		s.emit(conn, Event{Type: EventHello}, Hello)
+		_, err = conn.Write(server.ConnectionStart(mechanisms(conn)))
+	case client.UnsupportedProtocol:
+		s.emit(conn, Event{Type: EventUnsupportedProtocol}, UnsupportedProtocol, conn.RemoteAddr(), amqp.DescribeProtocolHeader(msg.Header))
+		_, err = conn.Write(amqp.Hello)
+		conn.closed = true
 	case client.ConnectionStartOk:
-		s.Log.Printf(ConnectionStartOk, msg.User, msg.Pass, msg.Mechanism)
-		_, err = conn.Write(server.ConnectionTune)
+		conn.mu.Lock()
+		conn.blockable = hasCapability(msg.Properties, "connection.blocked")
+		conn.mu.Unlock()
+		return s.authenticate(conn, msg.Mechanism, msg.Response)
+	case client.ConnectionSecureOk:
+		return s.authenticate(conn, conn.mechanism, msg.Response)
 	case client.ConnectionTuneOk:
-		s.Log.Printf(ConnectionTuneOk)
-		_, err = conn.Write(server.ConnectionOpenOk)
+		s.emit(conn, Event{Type: EventConnectionTuneOk}, ConnectionTuneOk, msg.HeartbeatDelay)
+		conn.setLimits(negotiate(s.ChannelMax, msg.ChannelMax), negotiate(s.FrameMax, msg.FrameMax))
+		conn.startHeartbeat(time.Duration(msg.HeartbeatDelay) * time.Second)
 	case client.ConnectionOpen:
-		s.Log.Printf(ConnectionOpen, msg.VirtualHost)
-		// conn.Write(server.ConnectionOpenOk) // is this not according to protocol?
+		if !conn.account.canOpen(msg.VirtualHost) {
+			return s.closeWith(conn, amqp.NotAllowed, fmt.Sprintf(
+				"NOT_ALLOWED - access to vhost '%v' refused for user '%v'", msg.VirtualHost, conn.user))
+		}
+
+		s.AddVHost(msg.VirtualHost)
+		conn.mu.Lock()
+		conn.vhost = msg.VirtualHost
+		conn.mu.Unlock()
+		s.emit(conn, Event{Type: EventConnectionOpen}, ConnectionOpen, msg.VirtualHost)
+		_, err = conn.Write(server.ConnectionOpenOk)
+	case client.ConnectionClose:
+		s.emit(conn, Event{Type: EventConnectionClose, ReplyCode: msg.ReplyCode, ReplyText: msg.ReplyText}, ConnectionClose, msg.ReplyCode, msg.ReplyText)
+		_, err = conn.Write(server.ConnectionCloseOk)
+		conn.closed = true
 
 	// channels
 	case client.ChannelOpen:
-		s.Log.Printf(ChannelOpen, msg.Channel)
+		s.emit(conn, Event{Type: EventChannelOpen, Channel: msg.Channel}, ChannelOpen, msg.Channel)
+		conn.mu.Lock()
+		conn.channels[msg.Channel] = &channel{flow: true}
+		conn.mu.Unlock()
 		_, err = conn.Write(server.ChannelOpen(msg.Channel))
 	case client.ChannelClose:
-		s.Log.Printf(ChannelClose, msg.Channel)
+		s.emit(conn, Event{Type: EventChannelClose, Channel: msg.Channel}, ChannelClose, msg.Channel)
+		conn.mu.Lock()
+		delete(conn.channels, msg.Channel)
+		conn.mu.Unlock()
+		s.cancel(conn.id, onChannel(msg.Channel))
 		_, err = conn.Write(server.ChannelClose(msg.Channel))
+	case client.ChannelCloseOk:
+		s.emit(conn, Event{Type: EventChannelClose, Channel: msg.Channel}, ChannelClose, msg.Channel)
+		conn.mu.Lock()
+		delete(conn.channels, msg.Channel)
+		conn.mu.Unlock()
+		s.cancel(conn.id, onChannel(msg.Channel))
+	case client.ChannelFlow:
+		s.emit(conn, Event{Type: EventClientFlow, Channel: msg.Channel}, ClientFlow, msg.Channel, msg.Active)
+		_, err = conn.Write(server.ChannelFlowOk(msg.Channel, msg.Active))
+	case client.ChannelFlowOk:
+		s.emit(conn, Event{Type: EventChannelFlowOk, Channel: msg.Channel}, ChannelFlowOk, msg.Channel, msg.Active)
 
 	// exchange
 	case client.ExchangeDeclare:
-		s.Log.Printf(ExchangeDeclare, msg.Exchange, msg.Typ)
-		_, err = conn.Write(server.ExchangeDeclareOk(msg.Channel))
+		// passive declares only check that the exchange exists, like in RabbitMQ they need no permission
+		if !msg.Passive && !conn.account.allowed(conn.vhost, accessConfigure, exchangeResource(msg.Exchange)) {
+			return s.refuse(conn, msg.Channel, accessConfigure, "exchange", exchangeResource(msg.Exchange), amqp.ClassExchange, amqp.MethodExchangeDeclare)
+		}
+
+		err = s.declareExchange(ExchangeInfo{
+			VHost:      conn.vhost,
+			Name:       msg.Exchange,
+			Type:       msg.Typ,
+			Durable:    msg.Durable,
+			AutoDelete: msg.AutoDelete,
+			Internal:   msg.Internal,
+			Arguments:  msg.Arguments,
+		}, msg.Passive)
+		if err != nil {
+			return s.brokerFailed(conn, msg.Channel, err, amqp.ClassExchange, amqp.MethodExchangeDeclare)
+		}
+		s.emit(conn, Event{Type: EventExchangeDeclare, Channel: msg.Channel, Exchange: msg.Exchange, ExchangeType: msg.Typ},
+			ExchangeDeclare, msg.Exchange, msg.Typ)
+		if !msg.NoWait {
+			_, err = conn.Write(server.ExchangeDeclareOk(msg.Channel))
+		}
+	case client.ExchangeDelete:
+		if !conn.account.allowed(conn.vhost, accessConfigure, exchangeResource(msg.Exchange)) {
+			return s.refuse(conn, msg.Channel, accessConfigure, "exchange", exchangeResource(msg.Exchange), amqp.ClassExchange, amqp.MethodExchangeDelete)
+		}
+
+		if err := s.deleteExchange(conn.vhost, msg.Exchange, msg.IfUnused); err != nil {
+			return s.brokerFailed(conn, msg.Channel, err, amqp.ClassExchange, amqp.MethodExchangeDelete)
+		}
+		s.emit(conn, Event{Type: EventExchangeDelete, Channel: msg.Channel, Exchange: msg.Exchange}, ExchangeDelete, msg.Exchange)
+		if !msg.NoWait {
+			_, err = conn.Write(server.ExchangeDeleteOk(msg.Channel))
+		}
+
+	// queue
+	case client.QueueDeclare:
+		name := msg.Queue
+		if !msg.Passive {
+			if err := reservedQueue(name); err != nil {
+				return s.brokerFailed(conn, msg.Channel, err, amqp.ClassQueue, amqp.MethodQueueDeclare)
+			}
+			// server-named queues need the same permission as the name they are given
+			if name == "" {
+				name = generateName("amq.gen-")
+			}
+			if !conn.account.allowed(conn.vhost, accessConfigure, name) {
+				return s.refuse(conn, msg.Channel, accessConfigure, "queue", name, amqp.ClassQueue, amqp.MethodQueueDeclare)
+			}
+		}
+
+		q, err := s.declareQueue(QueueInfo{
+			VHost:      conn.vhost,
+			Name:       name,
+			Durable:    msg.Durable,
+			Exclusive:  msg.Exclusive,
+			AutoDelete: msg.AutoDelete,
+			Arguments:  msg.Arguments,
+			Owner:      conn.id,
+		}, msg.Passive)
+		if err != nil {
+			return s.brokerFailed(conn, msg.Channel, err, amqp.ClassQueue, amqp.MethodQueueDeclare)
+		}
+		s.emit(conn, Event{Type: EventQueueDeclare, Channel: msg.Channel, Queue: q.Name}, QueueDeclare, q.Name)
+		if !msg.NoWait {
+			_, err = conn.Write(server.QueueDeclareOk(msg.Channel, q.Name, uint32(q.Messages), uint32(q.Consumers)))
+		}
+		return err
+	case client.QueueBind:
+		if !conn.account.allowed(conn.vhost, accessWrite, msg.Queue) {
+			return s.refuse(conn, msg.Channel, accessWrite, "queue", msg.Queue, amqp.ClassQueue, amqp.MethodQueueBind)
+		}
+		if !conn.account.allowed(conn.vhost, accessRead, exchangeResource(msg.Exchange)) {
+			return s.refuse(conn, msg.Channel, accessRead, "exchange", exchangeResource(msg.Exchange), amqp.ClassQueue, amqp.MethodQueueBind)
+		}
+
+		b := BindingInfo{
+			VHost:           conn.vhost,
+			Source:          msg.Exchange,
+			Destination:     msg.Queue,
+			DestinationType: DestinationQueue,
+			RoutingKey:      msg.RoutingKey,
+			Arguments:       msg.Arguments,
+		}
+		if err := s.bind(b); err != nil {
+			return s.brokerFailed(conn, msg.Channel, err, amqp.ClassQueue, amqp.MethodQueueBind)
+		}
+		s.emit(conn, Event{Type: EventQueueBind, Channel: msg.Channel, Queue: msg.Queue, Exchange: msg.Exchange, RoutingKey: msg.RoutingKey},
+			QueueBind, msg.Queue, msg.Exchange, msg.RoutingKey)
+		if !msg.NoWait {
+			_, err = conn.Write(server.QueueBindOk(msg.Channel))
+		}
+	case client.QueueUnbind:
+		if !conn.account.allowed(conn.vhost, accessWrite, msg.Queue) {
+			return s.refuse(conn, msg.Channel, accessWrite, "queue", msg.Queue, amqp.ClassQueue, amqp.MethodQueueUnbind)
+		}
+		if !conn.account.allowed(conn.vhost, accessRead, exchangeResource(msg.Exchange)) {
+			return s.refuse(conn, msg.Channel, accessRead, "exchange", exchangeResource(msg.Exchange), amqp.ClassQueue, amqp.MethodQueueUnbind)
+		}
+
+		b := BindingInfo{
+			VHost:           conn.vhost,
+			Source:          msg.Exchange,
+			Destination:     msg.Queue,
+			DestinationType: DestinationQueue,
+			RoutingKey:      msg.RoutingKey,
+			Arguments:       msg.Arguments,
+		}
+		if err := s.unbind(b); err != nil {
+			return s.brokerFailed(conn, msg.Channel, err, amqp.ClassQueue, amqp.MethodQueueUnbind)
+		}
+		s.emit(conn, Event{Type: EventQueueUnbind, Channel: msg.Channel, Queue: msg.Queue, Exchange: msg.Exchange, RoutingKey: msg.RoutingKey},
+			QueueUnbind, msg.Queue, msg.Exchange, msg.RoutingKey)
+		_, err = conn.Write(server.QueueUnbindOk(msg.Channel))
+	case client.QueuePurge:
+		if !conn.account.allowed(conn.vhost, accessRead, msg.Queue) {
+			return s.refuse(conn, msg.Channel, accessRead, "queue", msg.Queue, amqp.ClassQueue, amqp.MethodQueuePurge)
+		}
+
+		purged, err := s.PurgeQueue(conn.vhost, msg.Queue)
+		if err != nil {
+			return s.brokerFailed(conn, msg.Channel, err, amqp.ClassQueue, amqp.MethodQueuePurge)
+		}
+		s.emit(conn, Event{Type: EventQueuePurge, Channel: msg.Channel, Queue: msg.Queue}, QueuePurge, msg.Queue, purged)
+		if !msg.NoWait {
+			_, err = conn.Write(server.QueuePurgeOk(msg.Channel, uint32(purged)))
+		}
+		return err
+	case client.QueueDelete:
+		if !conn.account.allowed(conn.vhost, accessConfigure, msg.Queue) {
+			return s.refuse(conn, msg.Channel, accessConfigure, "queue", msg.Queue, amqp.ClassQueue, amqp.MethodQueueDelete)
+		}
+
+		messages, err := s.deleteQueue(conn.vhost, msg.Queue, msg.IfUnused, msg.IfEmpty)
+		if err != nil {
+			return s.brokerFailed(conn, msg.Channel, err, amqp.ClassQueue, amqp.MethodQueueDelete)
+		}
+		s.emit(conn, Event{Type: EventQueueDelete, Channel: msg.Channel, Queue: msg.Queue}, QueueDelete, msg.Queue, messages)
+		if !msg.NoWait {
+			_, err = conn.Write(server.QueueDeleteOk(msg.Channel, uint32(messages)))
+		}
+		return err
 
 	// basic
+	case client.BasicConsume:
+		if !conn.account.allowed(conn.vhost, accessRead, msg.Queue) {
+			return s.refuse(conn, msg.Channel, accessRead, "queue", msg.Queue, amqp.ClassBasic, amqp.MethodBasicConsume)
+		}
+
+		tag, err := s.consume(conn.vhost, consumer{
+			conn:      conn.id,
+			channel:   msg.Channel,
+			tag:       msg.ConsumerTag,
+			queue:     msg.Queue,
+			exclusive: msg.Exclusive,
+		})
+		if err != nil {
+			return s.brokerFailed(conn, msg.Channel, err, amqp.ClassBasic, amqp.MethodBasicConsume)
+		}
+		s.emit(conn, Event{Type: EventBasicConsume, Channel: msg.Channel, Queue: msg.Queue, ConsumerTag: tag}, BasicConsume, tag, msg.Queue)
+		if !msg.NoWait {
+			_, err = conn.Write(server.BasicConsumeOk(msg.Channel, tag))
+		}
+		return err
+	case client.BasicCancel:
+		for _, queue := range s.cancel(conn.id, func(c *consumer) bool {
+			return c.channel == msg.Channel && c.tag == msg.ConsumerTag
+		}) {
+			s.emit(conn, Event{Type: EventBasicCancel, Channel: msg.Channel, Queue: queue, ConsumerTag: msg.ConsumerTag}, BasicCancel, msg.ConsumerTag)
+		}
+		// like RabbitMQ, cancelling an unknown consumer is not an error
+		if !msg.NoWait {
+			_, err = conn.Write(server.BasicCancelOk(msg.Channel, msg.ConsumerTag))
+		}
 	case client.BasicPublish:
-		s.Log.Printf(BasicPublish, msg.Exchange, msg.RoutingKey)
+		if !conn.account.allowed(conn.vhost, accessWrite, exchangeResource(msg.Exchange)) {
+			return s.refuse(conn, msg.Channel, accessWrite, "exchange", exchangeResource(msg.Exchange), amqp.ClassBasic, amqp.MethodBasicPublish)
+		}
+
+		conn.publishes[msg.Channel] = &publish{BasicPublish: msg}
+
+	case client.Header:
+		p, ok := conn.publishes[msg.Channel]
+		if !ok {
+			return s.closeWith(conn, amqp.UnexpectedFrame, fmt.Sprintf("content header on channel %v without publish", msg.Channel))
+		}
+		p.size = msg.BodySize
+		p.properties = msg.Properties
+		// the publish is logged once its headers are known, so that header filters apply to it
+		s.emit(conn, Event{Type: EventBasicPublish, Channel: p.Channel, Exchange: p.Exchange, RoutingKey: p.RoutingKey, Properties: &p.properties},
+			BasicPublish, p.Exchange, p.RoutingKey)
+
+		conn.mu.Lock()
+		blocked := conn.blocked
+		ch, ok := conn.channels[p.Channel]
+		paused := ok && !ch.flow
+		conn.mu.Unlock()
+		if blocked {
+			s.emit(conn, Event{Type: EventPublishWhileBlocked, Channel: p.Channel}, PublishWhileBlocked, conn.RemoteAddr())
+		}
+		if paused {
+			s.emit(conn, Event{Type: EventPublishWhilePaused, Channel: p.Channel}, PublishWhilePaused, p.Channel)
+		}
+
+		if p.size == 0 {
+			delete(conn.publishes, p.Channel)
+			s.received(conn, conn.vhost, p)
+		}
 
 	case client.Body:
-		s.Log.Printf(BasicBody, msg.Payload)
+		p, ok := conn.publishes[msg.Channel]
+		if !ok {
+			return s.closeWith(conn, amqp.UnexpectedFrame, fmt.Sprintf("content body on channel %v without publish", msg.Channel))
+		}
+		p.body = append(p.body, msg.Payload...)
+		if uint64(len(p.body)) >= p.size {
+			delete(conn.publishes, p.Channel)
+			s.received(conn, conn.vhost, p)
+		}
 
 	case client.Invalid:
-		s.Log.Printf(msg.Err)
+		s.metrics.invalidFrame()
+		if msg.Code != 0 {
+			return s.closeWith(conn, msg.Code, msg.Err)
+		}
+		s.emit(conn, Event{Type: EventInvalidFrame}, InvalidFrame, msg.Err)
 
 	// do nothing for those
 	case client.Heartbeat:
-	case client.Header:
 	case client.Nothing:
 	}
 
+	return err
+}
+
+// received is called once the complete content of a publish to `vhost` arrived.
+// `conn` is nil for messages published through the HTTP API.
+func (s *Server) received(conn *connection, vhost string, p *publish) {
+	event := Event{
+		Type:       EventMessage,
+		VHost:      vhost,
+		Channel:    p.Channel,
+		Exchange:   p.Exchange,
+		RoutingKey: p.RoutingKey,
+		Queues:     s.route(vhost, p.Exchange, p.RoutingKey, p.properties.Headers),
+		Properties: &p.properties,
+		Content:    p.body,
+		Size:       len(p.body),
+	}
+
+	s.record(conn, vhost, p)
+	s.metrics.message(vhost, p.Exchange, len(p.body))
+
+	encoding := p.properties.ContentEncoding
+	if s.RawBodies || encoding == "" {
+		event.setBody(p.body)
+		body := s.render(&event, p.body)
+		s.emit(conn, event, BasicBody, body)
+		return
+	}
+
+	decoded, err := content.Decode(p.body, encoding)
+	switch {
+	case err == nil:
+		event.Decoded = decoded
+		event.DecodedSize = len(decoded)
+		event.setBody(decoded)
+		body := s.render(&event, decoded)
+		s.emit(conn, event, BasicBodyDecoded, encoding, len(p.body), len(decoded), body)
+	case errors.Is(err, content.ErrUnsupportedEncoding): // e.g. a charset set as encoding
+		event.setBody(p.body)
+		body := s.render(&event, p.body)
+		s.emit(conn, event, BasicBody, body)
+	default:
+		event.setBody(p.body)
+		s.emit(conn, event, BasicBodyUndecodable, encoding, err, content.Render(p.body, ""))
+	}
+}
+
+// record appends the message `p` published to `vhost` to the capture file
+func (s *Server) record(conn *connection, vhost string, p *publish) {
+	if s.Record == nil {
+		return
+	}
+
+	err := s.Record.Write(capture.Message{
+		Time:       time.Now(),
+		VHost:      vhost,
+		Exchange:   p.Exchange,
+		RoutingKey: p.RoutingKey,
+		Properties: p.properties,
+		Body:       p.body,
+	})
 	if err != nil {
-		panic(err)
+		s.emit(conn, Event{Type: EventServerError}, RecordFailed, err)
 	}
 }
 
-const bufferSize = 2048
+// recordFrame appends a frame read from or written to `conn` to the frame file
+func (s *Server) recordFrame(conn *connection, direction string, frame []byte) {
+	err := s.Frames.Write(capture.Frame{
+		Time:       time.Now(),
+		Connection: conn.id,
+		Client:     conn.RemoteAddr().String(),
+		Server:     conn.LocalAddr().String(),
+		Direction:  direction,
+		Data:       frame,
+	})
+	if err != nil {
+		s.emit(conn, Event{Type: EventServerError}, RecordFailed, err)
+	}
+}
 
-func Stream(conn net.Conn) chan client.Message {
-	stream := make(chan client.Message)
-	go func() {
-		defer close(stream)
+// trace logs a frame read from or written to `conn`
+func (s *Server) trace(conn *connection, direction string, frame []byte) {
+	format := FrameRead
+	if direction == capture.Outbound {
+		format = FrameWritten
+	}
 
-		for {
-			buf := make([]byte, bufferSize)
-			size, err := conn.Read(buf)
+	event := Event{Type: EventFrame, Direction: direction, Frame: frame}
+	if len(frame) >= amqp.FrameHeaderSize && !bytes.HasPrefix(frame, []byte("AMQP")) {
+		event.Channel = amqp.FrameChannel(frame)
+	}
+	s.emit(conn, event, format, amqp.Describe(frame), strings.TrimSuffix(hex.Dump(frame), "\n"))
+}
 
-			switch {
-			case errors.Is(err, io.EOF):
-				continue
+// render formats `body` of the message `event` reports for the log.
+// Protobuf bodies are decoded and stored in `event`.
+func (s *Server) render(event *Event, body []byte) string {
+	if s.RawBodies {
+		return string(body)
+	}
 
-			case errors.Is(err, syscall.ECONNRESET):
-				fmt.Printf("Time out for %s", conn.RemoteAddr().String())
-				break
+	contentType := event.Properties.ContentType
+	if s.Protobuf == nil {
+		return content.Render(body, contentType)
+	}
 
-			case err != nil:
-				fmt.Println(err)
-				break
-			}
+	message, ok := s.Protobuf.MessageFor(event.Exchange, event.RoutingKey, event.Properties.Type)
+	if !ok {
+		return content.Render(body, contentType)
+	}
+	decoded, err := s.Protobuf.Decode(message, body)
+	if err != nil {
+		return fmt.Sprintf("could not decode %v: %v\n%v", message, err, content.Render(body, contentType))
+	}
+	event.Protobuf = decoded
 
-			msgDump := buf[:size]
-			if bytes.Contains(msgDump, []byte{206, 178}) { // todo: ugly edge case
-				stream <- amqp.Parse(msgDump)
-				continue
-			}
+	return content.Render(decoded, "application/json")
+}
+
+// handleClosing waits for the client to confirm a connection.close sent by the server
+func (s *Server) handleClosing(message client.Message, conn *connection) error {
+	switch message.(type) {
+	case client.ConnectionCloseOk:
+		conn.closed = true
+	case client.ConnectionClose:
+		conn.closed = true
+		_, err := conn.Write(server.ConnectionCloseOk)
+		return err
+	}
+
+	return nil
+}
+
+// refuse closes `channel` because the user lacks `access` permission on the exchange or queue `name`
+func (s *Server) refuse(conn *connection, channel uint16, access, kind, name string, class, method uint16) error {
+	text := fmt.Sprintf("ACCESS_REFUSED - %v access to %v '%v' in vhost '%v' refused for user '%v'",
+		access, kind, name, conn.vhost, conn.user)
+
+	return s.closeChannel(conn, channel, amqp.AccessRefused, text, class, method)
+}
+
+// brokerFailed closes `channel` with the reply code of a failed exchange or queue operation
+func (s *Server) brokerFailed(conn *connection, channel uint16, err error, class, method uint16) error {
+	var failed *brokerError
+	if !errors.As(err, &failed) {
+		return err
+	}
+
+	return s.closeChannel(conn, channel, failed.code, failed.text, class, method)
+}
+
+// closeChannel closes `channel` because the client caused a channel error
+func (s *Server) closeChannel(conn *connection, channel, code uint16, text string, class, method uint16) error {
+	s.emit(conn, Event{Type: EventChannelClosing, Channel: channel, ReplyCode: code, ReplyText: text}, ChannelClosing, channel, code, text)
+
+	conn.mu.Lock()
+	if ch, ok := conn.channels[channel]; ok {
+		ch.closing = true
+	}
+	conn.mu.Unlock()
+	delete(conn.publishes, channel)
+
+	_, err := conn.Write(server.ChannelCloseWith(channel, code, text, class, method))
+
+	return err
+}
+
+// closeWith closes the connection because the client violated the protocol
+func (s *Server) closeWith(conn *connection, code uint16, text string) error {
+	s.emit(conn, Event{Type: EventConnectionClosing, ReplyCode: code, ReplyText: text}, ConnectionClosing, conn.RemoteAddr(), code, text)
+	conn.startClosing()
+	_, err := conn.Write(server.ConnectionClose(code, text, 0, 0))
+
+	return err
+}
+
+// hasCapability reports whether the client properties announce support for `capability`
+func hasCapability(properties map[string]any, capability string) bool {
+	capabilities, ok := properties["capabilities"].(map[string]any)
+	if !ok {
+		return false
+	}
+	supported, _ := capabilities[capability].(bool)
+
+	return supported
+}
+
+// negotiate picks the lower of the server's and the client's limit where 0 means no limit
+func negotiate[T uint16 | uint32](server, client T) T {
+	if server == 0 || (client != 0 && client < server) {
+		return client
+	}
+
+	return server
+}
+
+// heartbeatSeconds is the heartbeat delay proposed to clients in connection.tune
+func (s *Server) heartbeatSeconds() uint16 {
+	if s.Heartbeat < 0 {
+		return 0
+	}
+
+	return uint16(s.Heartbeat / time.Second)
+}
 
-			msgs := bytes.Split(msgDump, []byte{amqp.EndMark})
-			for _, msg := range msgs {
-				stream <- amqp.Parse(msg)
+// Stream parses the messages a client sends on `conn` until it closes the connection.
+// Frames are read whole, so messages split across or packed into TCP reads are parsed correctly.
+//
+// Deprecated: Stream does not enforce frame-max or channel-max and drops the channel of
+// every frame. Run a Server instead, or read frames with amqp.ReadFrame and amqp.Parse.
+func Stream(conn net.Conn) chan client.Message {
+	stream := make(chan client.Message)
+	go func() {
+		defer close(stream)
+
+		header, err := amqp.ReadProtocolHeader(conn)
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(header, amqp.Hello) {
+			stream <- client.UnsupportedProtocol{Header: header}
+			return
+		}
+		stream <- client.Hello{}
+
+		for {
+			frame, err := amqp.ReadFrame(conn, 0)
+			if err != nil {
+				return
 			}
+			stream <- amqp.Parse(frame)
 		}
 	}()
 
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+)
+
+// logAttrs passes `event` to Handler with the connection and channel it happened on as attributes
+func (s *Server) logAttrs(event Event) {
+	logger := slog.New(s.Handler)
+	level := eventLevel(event.Type)
+	if !logger.Enabled(context.Background(), level) {
+		return
+	}
+
+	attrs := []slog.Attr{slog.String("event", string(event.Type))}
+	if event.Connection != 0 {
+		attrs = append(attrs, slog.Uint64("connection", event.Connection))
+	}
+	strs := []struct{ key, value string }{
+		{"remote_addr", event.RemoteAddr},
+		{"user", event.User},
+		{"vhost", event.VHost},
+	}
+	for _, str := range strs {
+		if str.value != "" {
+			attrs = append(attrs, slog.String(str.key, str.value))
+		}
+	}
+	if event.Channel != 0 {
+		attrs = append(attrs, slog.Int("channel", int(event.Channel)))
+	}
+	strs = []struct{ key, value string }{
+		{"exchange", event.Exchange},
+		{"exchange_type", event.ExchangeType},
+		{"routing_key", event.RoutingKey},
+		{"queue", event.Queue},
+	}
+	for _, str := range strs {
+		if str.value != "" {
+			attrs = append(attrs, slog.String(str.key, str.value))
+		}
+	}
+	if event.ReplyCode != 0 {
+		attrs = append(attrs, slog.Int("reply_code", int(event.ReplyCode)), slog.String("reply_text", event.ReplyText))
+	}
+
+	logger.LogAttrs(context.Background(), level, event.Message, attrs...)
+}
+
+// eventLevel is the level events of type `typ` are logged with
+func eventLevel(typ EventType) slog.Level {
+	switch typ {
+	case EventServerError, EventConnectionError, EventConnectionClosing, EventInvalidFrame:
+		return slog.LevelError
+	case EventUnsupportedProtocol, EventConnectionLost, EventHeartbeatMissed, EventChannelClosing,
+		EventPublishWhileBlocked, EventPublishWhilePaused:
+		return slog.LevelWarn
+	case EventHello, EventConnectionSecure, EventConnectionTuneOk, EventConnectionAccepted, EventFrame:
+		return slog.LevelDebug
+	}
+
+	return slog.LevelInfo
+}
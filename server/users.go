@@ -0,0 +1,274 @@
+package server
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"os"
+	"regexp"
+)
+
+// User is an account clients can log in with
+type User struct {
+	Name     string `json:"name"`
+	Password string `json:"password,omitempty"`
+
+	// PasswordHash is used instead of Password if set. It is a salted hash as found in
+	// RabbitMQ definitions, computed with HashingAlgorithm which defaults to SHA-256.
+	// The server hashes a Password once when it starts, so exported definitions stay the same.
+	PasswordHash     string `json:"password_hash,omitempty"`
+	HashingAlgorithm string `json:"hashing_algorithm,omitempty"`
+
+	// Tags like administrator are exported with the definitions. Like in RabbitMQ, only users
+	// tagged management, policymaker, monitoring or administrator may use the HTTP API.
+	Tags []string `json:"tags,omitempty"`
+
+	// Permissions of the user by vhost. Vhosts without permissions cannot be opened.
+	Permissions map[string]Permission `json:"permissions"`
+}
+
+// Permission holds regular expressions of the resources a user may access
+// within a vhost, just like `rabbitmqctl set_permissions`. An empty expression matches nothing.
+type Permission struct {
+	// Configure covers declaring exchanges and queues
+	Configure string `json:"configure"`
+	// Write covers publishing to exchanges
+	Write string `json:"write"`
+	// Read covers consuming from queues
+	Read string `json:"read"`
+}
+
+// LoadUsers reads users from a JSON file of the form
+//
+//	[{"name": "guest", "password": "guest", "permissions": {"/": {"configure": ".*", "write": ".*", "read": ".*"}}}]
+func LoadUsers(path string) ([]User, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read users: %w", err)
+	}
+
+	var users []User
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("could not parse users: %w", err)
+	}
+
+	return users, nil
+}
+
+// mergeUsers adds `added` to `users`, replacing users of the same name
+func mergeUsers(users, added []User) []User {
+	merged := make([]User, 0, len(users)+len(added))
+	for _, u := range users {
+		replaced := false
+		for _, a := range added {
+			replaced = replaced || a.Name == u.Name
+		}
+		if !replaced {
+			merged = append(merged, u)
+		}
+	}
+
+	return append(merged, added...)
+}
+
+// hashPasswords returns a copy of `users` where users with only a Password got a PasswordHash
+func hashPasswords(users []User) []User {
+	if users == nil {
+		return nil
+	}
+
+	hashed := make([]User, len(users))
+	for i, u := range users {
+		if u.PasswordHash == "" && u.Password != "" {
+			u.PasswordHash, u.HashingAlgorithm = PasswordHash(u.Password), HashingSHA256
+		}
+		hashed[i] = u
+	}
+
+	return hashed
+}
+
+// account is a User with compiled permissions
+type account struct {
+	password    string
+	hash        []byte
+	hashing     string
+	tags        []string
+	permissions map[string]permission
+}
+
+type permission struct {
+	configure, write, read *regexp.Regexp
+}
+
+// compileUsers prepares the user store; a nil store accepts every login
+func compileUsers(users []User) (map[string]*account, error) {
+	if users == nil {
+		return nil, nil
+	}
+
+	accounts := make(map[string]*account, len(users))
+	for _, u := range users {
+		acc := &account{
+			password:    u.Password,
+			hashing:     u.HashingAlgorithm,
+			tags:        u.Tags,
+			permissions: make(map[string]permission, len(u.Permissions)),
+		}
+		if u.PasswordHash != "" {
+			hash, err := base64.StdEncoding.DecodeString(u.PasswordHash)
+			if err != nil || len(hash) <= saltSize {
+				return nil, fmt.Errorf("invalid password hash of %q", u.Name)
+			}
+			if _, ok := hashes[acc.hashing]; !ok {
+				return nil, fmt.Errorf("unsupported hashing algorithm %q of %q", acc.hashing, u.Name)
+			}
+			acc.hash = hash
+		}
+
+		for vhost, p := range u.Permissions {
+			var (
+				perm permission
+				err  error
+			)
+			if perm.configure, err = compilePermission(p.Configure); err != nil {
+				return nil, fmt.Errorf("configure permission of %q in %q: %w", u.Name, vhost, err)
+			}
+			if perm.write, err = compilePermission(p.Write); err != nil {
+				return nil, fmt.Errorf("write permission of %q in %q: %w", u.Name, vhost, err)
+			}
+			if perm.read, err = compilePermission(p.Read); err != nil {
+				return nil, fmt.Errorf("read permission of %q in %q: %w", u.Name, vhost, err)
+			}
+			acc.permissions[vhost] = perm
+		}
+
+		accounts[u.Name] = acc
+	}
+
+	return accounts, nil
+}
+
+func compilePermission(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+
+	return regexp.Compile(expr)
+}
+
+// saltSize is the length of the salt RabbitMQ puts in front of password hashes
+const saltSize = 4
+
+// Hashing algorithms of RabbitMQ password hashes
+const (
+	HashingSHA256 = "rabbit_password_hashing_sha256"
+	HashingSHA512 = "rabbit_password_hashing_sha512"
+	HashingMD5    = "rabbit_password_hashing_md5"
+)
+
+var hashes = map[string]func() hash.Hash{
+	"":            sha256.New,
+	HashingSHA256: sha256.New,
+	HashingSHA512: sha512.New,
+	HashingMD5:    md5.New,
+}
+
+// checkPassword reports whether `pass` is the password of the account
+func (a *account) checkPassword(pass string) bool {
+	if a.hash == nil {
+		return subtle.ConstantTimeCompare([]byte(a.password), []byte(pass)) == 1
+	}
+
+	salt := a.hash[:saltSize]
+	return subtle.ConstantTimeCompare(hashPassword(a.hashing, salt, pass)[saltSize:], a.hash[saltSize:]) == 1
+}
+
+// hashPassword computes a salted hash the way RabbitMQ does: salt followed by hash(salt + password)
+func hashPassword(algorithm string, salt []byte, pass string) []byte {
+	h := hashes[algorithm]()
+	h.Write(salt)
+	h.Write([]byte(pass))
+
+	return h.Sum(append([]byte(nil), salt...))
+}
+
+// PasswordHash returns the RabbitMQ SHA-256 password hash of `pass` with a random salt
+func PasswordHash(pass string) string {
+	salt := make([]byte, saltSize)
+	rand.Read(salt)
+
+	return base64.StdEncoding.EncodeToString(hashPassword(HashingSHA256, salt, pass))
+}
+
+// Access kinds checked against a user's permissions
+const (
+	accessConfigure = "configure"
+	accessWrite     = "write"
+	accessRead      = "read"
+)
+
+// allowed reports whether the account may access `resource` in `vhost`.
+// A nil account belongs to a server without user store and may do anything.
+func (a *account) allowed(vhost, access, resource string) bool {
+	if a == nil {
+		return true
+	}
+
+	perm, ok := a.permissions[vhost]
+	if !ok {
+		return false
+	}
+
+	var re *regexp.Regexp
+	switch access {
+	case accessConfigure:
+		re = perm.configure
+	case accessWrite:
+		re = perm.write
+	case accessRead:
+		re = perm.read
+	}
+
+	return re != nil && re.MatchString(resource)
+}
+
+// canOpen reports whether the account has any permissions in `vhost`
+func (a *account) canOpen(vhost string) bool {
+	if a == nil {
+		return true
+	}
+	_, ok := a.permissions[vhost]
+
+	return ok
+}
+
+// canManage reports whether the account may use the HTTP API
+func (a *account) canManage() bool {
+	if a == nil {
+		return true
+	}
+	for _, tag := range a.tags {
+		switch tag {
+		case "management", "policymaker", "monitoring", "administrator":
+			return true
+		}
+	}
+
+	return false
+}
+
+// exchangeResource is the name permissions are checked against; RabbitMQ calls the default exchange amq.default
+func exchangeResource(exchange string) string {
+	if exchange == "" {
+		return "amq.default"
+	}
+
+	return exchange
+}
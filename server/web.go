@@ -0,0 +1,70 @@
+package server
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"time"
+)
+
+// webFiles are the pages of the web UI served under /ui/
+//
+//go:embed web
+var webFiles embed.FS
+
+// eventsBuffer is the number of events buffered for each web UI before it misses events
+const eventsBuffer = 1024
+
+// keepAlive is how often an idle event stream is written to, so that proxies keep it open
+const keepAlive = 15 * time.Second
+
+// webUI serves the embedded web UI
+//
+//	GET /ui/
+func webUI() http.Handler {
+	files, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err) // the directory is embedded, so this cannot fail
+	}
+
+	return http.StripPrefix("/ui", http.FileServer(http.FS(files)))
+}
+
+// httpEvents streams every event from now on as Server-Sent Events, each holding the event in JSON
+//
+//	GET /events
+func (s *Server) httpEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, cancel := s.Subscribe(eventsBuffer)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-events:
+			fmt.Fprintf(w, "data: %s\n\n", marshalEvent(event))
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,191 @@
+// amqparrot web UI: lists connections and streams events from /events
+
+'use strict';
+
+const maxEvents = 1000;
+const errors = new Set([
+  'server.error', 'connection.error', 'connection.lost', 'connection.heartbeat-missed', 'frame.invalid',
+]);
+
+const filter = document.getElementById('filter');
+const messagesOnly = document.getElementById('messages-only');
+const pause = document.getElementById('pause');
+const status = document.getElementById('status');
+const count = document.getElementById('count');
+const connections = document.querySelector('#connections tbody');
+const events = document.querySelector('#events tbody');
+
+let paused = false;
+let held = []; // events received while paused
+let refresh = null;
+
+function cell(row, text, className) {
+  const td = row.insertCell();
+  td.textContent = text === undefined ? '' : String(text);
+  if (className) {
+    td.className = className;
+  }
+  return td;
+}
+
+function body(event) {
+  if (event.protobuf) {
+    return JSON.stringify(event.protobuf);
+  }
+  return event.body !== undefined ? event.body : (event.body_base64 || '');
+}
+
+function matches(event) {
+  if (messagesOnly.checked && event.event !== 'message') {
+    return false;
+  }
+  const text = filter.value.trim().toLowerCase();
+  return text === '' || JSON.stringify(event).toLowerCase().includes(text);
+}
+
+function details(event) {
+  const row = document.createElement('tr');
+  row.className = 'details';
+  const td = row.insertCell();
+  td.colSpan = 9;
+  const parts = [['Message', event.message]];
+  if (event.properties) {
+    parts.push(['Properties', JSON.stringify(event.properties, null, 2)]);
+  }
+  if (event.event === 'message') {
+    parts.push([event.body_base64 ? 'Body (base64)' : 'Body', body(event)]);
+  }
+  for (const [title, text] of parts) {
+    const h = document.createElement('strong');
+    h.textContent = title;
+    const pre = document.createElement('pre');
+    pre.textContent = text;
+    td.append(h, pre);
+  }
+  return row;
+}
+
+function add(event) {
+  const row = document.createElement('tr');
+  row.className = 'event' + (errors.has(event.event) ? ' error' : '');
+  row.event = event;
+  row.hidden = !matches(event);
+  cell(row, new Date(event.timestamp).toLocaleTimeString());
+  cell(row, event.event);
+  cell(row, event.connection);
+  cell(row, event.channel);
+  cell(row, event.exchange);
+  cell(row, event.routing_key);
+  cell(row, (event.queues || []).join(', '));
+  cell(row, event.size);
+  cell(row, event.event === 'message' ? body(event) : event.message, 'body');
+  row.addEventListener('click', () => {
+    const next = row.nextSibling;
+    if (next && next.className === 'details') {
+      next.remove();
+    } else {
+      row.after(details(event));
+    }
+  });
+
+  events.prepend(row);
+  const rows = events.querySelectorAll('tr.event');
+  for (let i = maxEvents; i < rows.length; i++) {
+    const next = rows[i].nextSibling;
+    if (next && next.className === 'details') {
+      next.remove();
+    }
+    rows[i].remove();
+  }
+  counted();
+}
+
+function counted() {
+  const rows = events.querySelectorAll('tr.event');
+  const shown = [...rows].filter(row => !row.hidden).length;
+  count.textContent = `(${shown} of ${rows.length})`;
+}
+
+function refilter() {
+  for (const row of events.querySelectorAll('tr.event')) {
+    row.hidden = !matches(row.event);
+    const next = row.nextSibling;
+    if (next && next.className === 'details') {
+      next.hidden = row.hidden;
+    }
+  }
+  counted();
+}
+
+async function loadConnections() {
+  const response = await fetch('/connections');
+  const list = await response.json();
+  connections.replaceChildren();
+  for (const c of list) {
+    const row = connections.insertRow();
+    cell(row, c.id);
+    cell(row, c.remote_addr);
+    cell(row, c.user);
+    cell(row, c.vhost);
+    cell(row, (c.channels || []).map(ch => ch.id).join(', '));
+    cell(row, c.blocked ? 'blocked' : 'running');
+  }
+}
+
+// reloadConnections coalesces the reloads of a burst of connection and channel events
+function reloadConnections() {
+  clearTimeout(refresh);
+  refresh = setTimeout(loadConnections, 200);
+}
+
+function received(event) {
+  if (event.event.startsWith('connection.') || event.event.startsWith('channel.')) {
+    reloadConnections();
+  }
+  if (paused) {
+    held.push(event);
+    if (held.length > maxEvents) {
+      held.shift(); // only the newest maxEvents are shown after resuming anyway
+    }
+  } else {
+    add(event);
+  }
+}
+
+function connect() {
+  const source = new EventSource('/events');
+  source.onopen = () => {
+    status.textContent = paused ? 'paused' : 'connected';
+    status.className = paused ? 'paused' : 'connected';
+    loadConnections();
+  };
+  source.onerror = () => {
+    status.textContent = 'disconnected';
+    status.className = 'disconnected';
+  };
+  source.onmessage = message => received(JSON.parse(message.data));
+}
+
+filter.addEventListener('input', refilter);
+messagesOnly.addEventListener('change', refilter);
+pause.addEventListener('click', () => {
+  paused = !paused;
+  pause.textContent = paused ? 'Resume' : 'Pause';
+  if (status.className !== 'disconnected') {
+    status.textContent = paused ? 'paused' : 'connected';
+    status.className = paused ? 'paused' : 'connected';
+  }
+  if (!paused) {
+    held.forEach(add);
+    held = [];
+  }
+});
+document.getElementById('clear').addEventListener('click', () => {
+  events.replaceChildren();
+  counted();
+});
+
+fetch('/messages')
+  .then(response => response.json())
+  .then(messages => messages.forEach(add))
+  .finally(connect);
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+)
+
+// ANSI escape sequences used by the terminal UI
+const (
+	altScreen   = "\x1b[?1049h"
+	mainScreen  = "\x1b[?1049l"
+	hideCursor  = "\x1b[?25l"
+	showCursor  = "\x1b[?25h"
+	cursorHome  = "\x1b[H"
+	clearLine   = "\x1b[K"
+	clearBelow  = "\x1b[J"
+	styleReset  = "\x1b[0m"
+	styleBold   = "\x1b[1m"
+	styleDim    = "\x1b[2m"
+	styleRed    = "\x1b[31m"
+	styleYellow = "\x1b[33m"
+	styleInvert = "\x1b[7m"
+)
+
+// terminal is stdin and stdout switched to raw mode through stty until restore is called
+type terminal struct {
+	saved string
+}
+
+// openTerminal puts the terminal in raw mode and switches to the alternate screen
+func openTerminal() (*terminal, error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+
+	os.Stdout.WriteString(altScreen + hideCursor)
+	return &terminal{saved: strings.TrimSpace(saved)}, nil
+}
+
+// restore returns to the main screen and the terminal settings from before openTerminal
+func (t *terminal) restore() {
+	os.Stdout.WriteString(styleReset + showCursor + mainScreen)
+	stty(t.saved)
+}
+
+// size returns the number of rows and columns of the terminal
+func (t *terminal) size() (rows, cols int) {
+	out, err := stty("size")
+	if err != nil {
+		return 24, 80
+	}
+	if _, err := fmt.Sscan(out, &rows, &cols); err != nil || rows <= 0 || cols <= 0 {
+		return 24, 80
+	}
+
+	return rows, cols
+}
+
+// stty runs stty on the terminal connected to stdin
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("stty %v failed: %w", strings.Join(args, " "), err)
+	}
+
+	return string(out), nil
+}
+
+// copyToClipboard asks the terminal to put `data` into the system clipboard with OSC 52,
+// which also works through SSH and tmux given set-clipboard is on
+func copyToClipboard(data []byte) {
+	os.Stdout.WriteString("\x1b]52;c;" + base64.StdEncoding.EncodeToString(data) + "\a")
+}
+
+// key is a key pressed in the terminal; printable keys are key(rune)
+type key rune
+
+// Keys without a printable rune, chosen from the Unicode private use area
+const (
+	keyUp key = 0xe000 + iota
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyEnter
+	keyEscape
+	keyBackspace
+	keyInterrupt
+	keyUnknown
+)
+
+// escapes maps the escape sequences of special keys that terminals commonly send
+var escapes = map[string]key{
+	"\x1b[A":  keyUp,
+	"\x1b[B":  keyDown,
+	"\x1bOA":  keyUp,
+	"\x1bOB":  keyDown,
+	"\x1b[5~": keyPageUp,
+	"\x1b[6~": keyPageDown,
+	"\x1b[H":  keyHome,
+	"\x1b[F":  keyEnd,
+	"\x1bOH":  keyHome,
+	"\x1bOF":  keyEnd,
+	"\x1b[1~": keyHome,
+	"\x1b[4~": keyEnd,
+}
+
+// parseKeys splits what was read from the terminal into keys
+func parseKeys(input []byte) []key {
+	var keys []key
+	for len(input) > 0 {
+		switch c := input[0]; {
+		case c == 0x1b && len(input) == 1:
+			keys = append(keys, keyEscape)
+			input = input[1:]
+		case c == 0x1b:
+			// CSI and SS3 sequences end with the first byte in the range @ to ~ after the introducer
+			end := 2
+			if input[1] == '[' {
+				for end < len(input) && (input[end] < 0x40 || input[end] > 0x7e) {
+					end++
+				}
+			}
+			if (input[1] == '[' || input[1] == 'O') && end < len(input) {
+				end++
+			}
+			k, ok := escapes[string(input[:end])]
+			if !ok {
+				k = keyUnknown
+			}
+			keys = append(keys, k)
+			input = input[end:]
+		case c == '\r' || c == '\n':
+			keys = append(keys, keyEnter)
+			input = input[1:]
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, keyBackspace)
+			input = input[1:]
+		case c == 0x03:
+			keys = append(keys, keyInterrupt)
+			input = input[1:]
+		case c < 0x20:
+			input = input[1:]
+		default:
+			r, size := utf8.DecodeRune(input)
+			keys = append(keys, key(r))
+			input = input[size:]
+		}
+	}
+
+	return keys
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// notifyResize does nothing where terminals do not signal resizes, so the size read at start is kept
+func notifyResize(c chan<- os.Signal) {}
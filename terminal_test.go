@@ -0,0 +1,29 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	for _, tc := range []struct {
+		name, input string
+		expected    []key
+	}{
+		{"printable", "qé/", []key{'q', 'é', '/'}},
+		{"arrows", "\x1b[A\x1b[B\x1bOA\x1bOB", []key{keyUp, keyDown, keyUp, keyDown}},
+		{"paging", "\x1b[5~\x1b[6~", []key{keyPageUp, keyPageDown}},
+		{"home and end", "\x1b[H\x1b[F\x1b[1~\x1b[4~\x1bOH", []key{keyHome, keyEnd, keyHome, keyEnd, keyHome}},
+		{"escape alone", "\x1b", []key{keyEscape}},
+		{"unknown sequence", "\x1b[15~x", []key{keyUnknown, 'x'}},
+		{"enter, backspace and interrupt", "\r\n\x7f\x08\x03", []key{keyEnter, keyEnter, keyBackspace, keyBackspace, keyInterrupt}},
+		{"other control characters", "\x01a\x1f", []key{'a'}},
+		{"incomplete sequence", "\x1b[", []key{keyUnknown}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if keys := parseKeys([]byte(tc.input)); !reflect.DeepEqual(keys, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, keys)
+			}
+		})
+	}
+}
@@ -0,0 +1,642 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/resamvi/amqparrot/server"
+)
+
+const (
+	// tuiMessages is the number of messages the terminal UI keeps
+	tuiMessages = 1000
+	// tuiBuffer is the number of events buffered before the terminal UI misses events
+	tuiBuffer = 4096
+	// tuiRefresh limits how often the terminal UI redraws while events arrive
+	tuiRefresh = 100 * time.Millisecond
+
+	tuiHelp = "q quit  ↑↓ select  ⏎ inspect  / filter  p pause  c copy body"
+)
+
+// message is a received message numbered in the order of arrival
+type message struct {
+	n int
+	server.Event
+}
+
+// tui shows the connections, channels, exchanges and messages of a running server in the terminal
+type tui struct {
+	srv        *server.Server
+	term       *terminal
+	rows, cols int
+
+	messages []message
+	received int
+	// held are the messages received while paused
+	held   []server.Event
+	paused bool
+
+	filter  string
+	editing bool
+	// selected is the number of the selected message unless follow selects the newest one
+	selected int
+	follow   bool
+	// top is the index of the first message on screen in the filtered list
+	top int
+
+	// inspected is shown with all its properties and body, scrolled by `scroll` lines
+	inspected *message
+	scroll    int
+
+	// notice is the last server event or the result of an action, shown in the status line
+	notice      string
+	noticeError bool
+}
+
+// runTUI starts `srv` and shows what happens on it in the terminal instead of logging it
+func runTUI(srv *server.Server) error {
+	srv.Log = log.New(io.Discard, "", 0)
+	srv.Handler = nil
+	srv.Format = server.FormatText
+
+	term, err := openTerminal()
+	if err != nil {
+		return fmt.Errorf("tui needs an interactive terminal: %w", err)
+	}
+	defer term.restore()
+
+	events, cancel := srv.Subscribe(tuiBuffer)
+	defer cancel()
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- srv.Start() }()
+
+	t := &tui{srv: srv, term: term, follow: true}
+	t.rows, t.cols = term.size()
+	return t.run(events, stopped)
+}
+
+// run handles events and keys until the user quits or the server stops
+func (t *tui) run(events <-chan server.Event, stopped <-chan error) error {
+	input := make(chan []key)
+	go readKeys(input)
+
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+	defer signal.Stop(resized)
+
+	ticker := time.NewTicker(tuiRefresh)
+	defer ticker.Stop()
+
+	t.draw()
+	dirty := false
+	for {
+		select {
+		case err := <-stopped:
+			return err
+		case event := <-events:
+			t.add(event)
+			dirty = true
+		case <-ticker.C:
+			if dirty {
+				t.draw()
+				dirty = false
+			}
+		case <-resized:
+			t.rows, t.cols = t.term.size()
+			t.draw()
+		case keys, ok := <-input:
+			if !ok {
+				return nil
+			}
+			for _, k := range keys {
+				if !t.press(k) {
+					return nil
+				}
+			}
+			t.draw()
+			dirty = false
+		}
+	}
+}
+
+// readKeys sends the keys pressed to `input` until stdin is closed
+func readKeys(input chan<- []key) {
+	buf := make([]byte, 256)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if n > 0 {
+			input <- parseKeys(buf[:n])
+		}
+		if err != nil {
+			close(input)
+			return
+		}
+	}
+}
+
+// add keeps a received message or shows any other event in the status line
+func (t *tui) add(event server.Event) {
+	if !t.srv.Filter.Allows(&event) {
+		return
+	}
+
+	switch {
+	case event.Type == server.EventFrame:
+	case event.Type != server.EventMessage:
+		t.notice = event.Message
+		t.noticeError = isProblem(event.Type)
+	case t.paused:
+		// only the newest tuiMessages are kept after resuming anyway
+		t.held = append(t.held, event)
+		if over := len(t.held) - tuiMessages; over > 0 {
+			t.held = append([]server.Event(nil), t.held[over:]...)
+		}
+	default:
+		t.keep(event)
+	}
+}
+
+// keep appends messages, dropping the oldest beyond tuiMessages
+func (t *tui) keep(events ...server.Event) {
+	for _, event := range events {
+		t.received++
+		t.messages = append(t.messages, message{n: t.received, Event: event})
+	}
+	if over := len(t.messages) - tuiMessages; over > 0 {
+		t.messages = append([]message(nil), t.messages[over:]...)
+	}
+}
+
+// isProblem reports whether an event of `typ` is shown as error
+func isProblem(typ server.EventType) bool {
+	switch typ {
+	case server.EventServerError, server.EventConnectionError, server.EventConnectionLost,
+		server.EventHeartbeatMissed, server.EventInvalidFrame, server.EventPublishWhileBlocked,
+		server.EventPublishWhilePaused:
+		return true
+	}
+
+	return false
+}
+
+// visible returns the messages matching the filter
+func (t *tui) visible() []*message {
+	filter := strings.ToLower(t.filter)
+	list := make([]*message, 0, len(t.messages))
+	for i := range t.messages {
+		if m := &t.messages[i]; filter == "" || strings.Contains(searchText(m), filter) {
+			list = append(list, m)
+		}
+	}
+
+	return list
+}
+
+// searchText is what the filter is matched against
+func searchText(m *message) string {
+	return strings.ToLower(strings.Join([]string{
+		m.VHost, m.User, m.Exchange, m.RoutingKey, strings.Join(m.Queues, " "), body(&m.Event),
+	}, "\n"))
+}
+
+// cursor returns the index of the selected message in `list`
+func (t *tui) cursor(list []*message) int {
+	if t.follow || len(list) == 0 {
+		return len(list) - 1
+	}
+
+	i := sort.Search(len(list), func(i int) bool { return list[i].n >= t.selected })
+	if i == len(list) {
+		return len(list) - 1
+	}
+	return i
+}
+
+// move selects the message `delta` rows away, following new messages once the newest is selected
+func (t *tui) move(delta int) {
+	list := t.visible()
+	if len(list) == 0 {
+		return
+	}
+
+	i := t.cursor(list) + delta
+	i = max(0, min(i, len(list)-1))
+	t.selected = list[i].n
+	t.follow = i == len(list)-1
+}
+
+// press handles a key and returns false to quit
+func (t *tui) press(k key) bool {
+	if k == keyInterrupt {
+		return false
+	}
+
+	switch {
+	case t.editing:
+		switch k {
+		case keyEnter:
+			t.editing = false
+		case keyEscape:
+			t.filter, t.editing = "", false
+		case keyBackspace:
+			_, size := utf8.DecodeLastRuneInString(t.filter)
+			t.filter = t.filter[:len(t.filter)-size]
+		default:
+			if unicode.IsPrint(rune(k)) {
+				t.filter += string(rune(k))
+			}
+		}
+
+	case t.inspected != nil:
+		page := t.rows - 2
+		switch k {
+		case 'q', keyEscape, keyEnter, keyBackspace:
+			t.inspected = nil
+		case keyUp, 'k':
+			t.scroll--
+		case keyDown, 'j':
+			t.scroll++
+		case keyPageUp:
+			t.scroll -= page
+		case keyPageDown, ' ':
+			t.scroll += page
+		case keyHome, 'g':
+			t.scroll = 0
+		case keyEnd, 'G':
+			t.scroll = len(t.details(t.inspected))
+		case 'c':
+			t.copy(t.inspected)
+		}
+
+	default:
+		page := t.listRows()
+		switch k {
+		case 'q':
+			return false
+		case keyUp, 'k':
+			t.move(-1)
+		case keyDown, 'j':
+			t.move(1)
+		case keyPageUp:
+			t.move(-page)
+		case keyPageDown, ' ':
+			t.move(page)
+		case keyHome, 'g':
+			t.move(-len(t.messages))
+		case keyEnd, 'G':
+			t.follow = true
+		case keyEnter:
+			if list := t.visible(); len(list) > 0 {
+				t.inspected, t.scroll = list[t.cursor(list)], 0
+			}
+		case '/':
+			t.editing = true
+		case keyEscape:
+			t.filter = ""
+		case 'p':
+			t.paused = !t.paused
+			if !t.paused {
+				t.keep(t.held...)
+				t.held = nil
+			}
+		case 'c':
+			if list := t.visible(); len(list) > 0 {
+				t.copy(list[t.cursor(list)])
+			}
+		}
+	}
+
+	return true
+}
+
+// copy puts the body of `m` into the clipboard, decoded if it was content-encoded
+func (t *tui) copy(m *message) {
+	data := m.Content
+	if m.Decoded != nil {
+		data = m.Decoded
+	}
+	copyToClipboard(data)
+	t.notice, t.noticeError = fmt.Sprintf("Copied %v bytes of message #%v to the clipboard", len(data), m.n), false
+}
+
+// draw writes the whole screen
+func (t *tui) draw() {
+	var lines []string
+	switch {
+	case t.rows < 8 || t.cols < 40:
+		lines = []string{fit("amqparrot: terminal too small", t.cols)}
+	case t.inspected != nil:
+		lines = t.inspectScreen()
+	default:
+		lines = t.mainScreen()
+	}
+
+	var b strings.Builder
+	b.WriteString(cursorHome)
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(clearLine + line + styleReset)
+	}
+	b.WriteString(clearBelow)
+	os.Stdout.WriteString(b.String())
+}
+
+// paneRows is the height of the connections, channels and exchanges panes including their title
+func (t *tui) paneRows() int {
+	return max(3, min((t.rows-3)/3, 10))
+}
+
+// listRows is the number of messages on screen below the panes, title, column header and status line
+func (t *tui) listRows() int {
+	return max(1, t.rows-3-t.paneRows())
+}
+
+func (t *tui) mainScreen() []string {
+	conns := t.srv.Connections()
+	channels := t.srv.Channels()
+	var exchanges []server.ExchangeInfo
+	for _, e := range t.srv.Exchanges("") {
+		if e.Name != "" && !strings.HasPrefix(e.Name, "amq.") {
+			exchanges = append(exchanges, e)
+		}
+	}
+
+	title := fmt.Sprintf(" amqparrot on port %v — %v connections, %v channels, %v messages",
+		t.srv.Port, len(conns), len(channels), t.received)
+	if t.paused {
+		title += fmt.Sprintf("  [paused, %v new]", len(t.held))
+	}
+	if t.filter != "" {
+		title += fmt.Sprintf("  [filter: %v]", t.filter)
+	}
+	lines := []string{styleInvert + fit(title, t.cols)}
+
+	// panes side by side
+	rows := t.paneRows() - 1
+	var panes [3][]string
+	for _, c := range conns {
+		state := ""
+		if c.Blocked {
+			state = " blocked"
+		}
+		panes[0] = append(panes[0], fmt.Sprintf("#%v %v@%v %v%v", c.ID, c.User, c.VHost, c.RemoteAddr, state))
+	}
+	for _, ch := range channels {
+		state := ""
+		if !ch.Flow {
+			state = " flow paused"
+		}
+		panes[1] = append(panes[1], fmt.Sprintf("#%v/%v%v", ch.Connection, ch.ID, state))
+	}
+	for _, e := range exchanges {
+		panes[2] = append(panes[2], fmt.Sprintf("%v %v (%v)", e.VHost, e.Name, e.Type))
+	}
+	width := (t.cols - 2) / 3
+	widths := [3]int{width, width, t.cols - 2 - 2*width}
+	titles := [3]string{"Connections", "Channels", "Exchanges"}
+	for y := -1; y < rows; y++ {
+		cells := make([]string, 3)
+		for i, pane := range panes {
+			switch {
+			case y < 0:
+				cells[i] = styleBold + fit(fmt.Sprintf("%v (%v)", titles[i], len(pane)), widths[i]) + styleReset
+			case y == rows-1 && len(pane) > rows:
+				cells[i] = styleDim + fit(fmt.Sprintf("… %v more", len(pane)-y), widths[i]) + styleReset
+			case y < len(pane):
+				cells[i] = fit(pane[y], widths[i])
+			default:
+				cells[i] = fit("", widths[i])
+			}
+		}
+		lines = append(lines, strings.Join(cells, "│"))
+	}
+
+	// message list
+	columns, bodyWidth := messageColumns(t.cols)
+	lines = append(lines, styleInvert+row(columns, bodyWidth,
+		"#", "TIME", "CONN", "EXCHANGE", "ROUTING KEY", "SIZE", "BODY"))
+
+	list := t.visible()
+	cursor := t.cursor(list)
+	height := t.listRows()
+	if cursor >= 0 {
+		t.top = max(min(t.top, cursor), cursor-height+1)
+	}
+	t.top = max(0, min(t.top, len(list)-height))
+	for i := t.top; i < t.top+height; i++ {
+		if i >= len(list) {
+			lines = append(lines, "")
+			continue
+		}
+		m := list[i]
+		line := row(columns, bodyWidth,
+			fmt.Sprint(m.n),
+			m.Time.Format("15:04:05"),
+			origin(m),
+			m.Exchange,
+			m.RoutingKey,
+			fmt.Sprint(m.Size),
+			body(&m.Event))
+		if i == cursor {
+			line = styleInvert + line
+		}
+		lines = append(lines, line)
+	}
+
+	return append(lines, t.statusLine())
+}
+
+// messageColumns returns the widths of the message list columns before the body and the width
+// of the body, so that rows are `cols` wide. Narrow terminals shrink exchange, routing key and body.
+func messageColumns(cols int) (columns []int, bodyWidth int) {
+	columns = []int{6, 8, 7, 18, 22, 7}
+	rest := cols - len(columns)
+	for i, width := range columns {
+		if i != 3 && i != 4 {
+			rest -= width
+		}
+	}
+	if rest < 18+22+10 {
+		columns[3] = rest * 18 / 50
+		columns[4] = rest * 22 / 50
+	}
+
+	return columns, rest - columns[3] - columns[4]
+}
+
+// origin returns the connection and channel a message was published on
+func origin(m *message) string {
+	if m.Connection == 0 {
+		return "http"
+	}
+	return fmt.Sprintf("%v/%v", m.Connection, m.Channel)
+}
+
+// row joins the cells of a table row, separated by a space
+func row(widths []int, last int, cells ...string) string {
+	var b strings.Builder
+	for i, cell := range cells {
+		if i < len(widths) {
+			b.WriteString(fit(cell, widths[i]) + " ")
+		} else {
+			b.WriteString(fit(cell, last))
+		}
+	}
+
+	return b.String()
+}
+
+func (t *tui) statusLine() string {
+	switch {
+	case t.editing:
+		return fit("/"+t.filter+"█", t.cols)
+	case t.notice == "":
+		return styleDim + fit(tuiHelp, t.cols)
+	}
+
+	style := ""
+	if t.noticeError {
+		style = styleRed
+	}
+	help := "  " + tuiHelp
+	if utf8.RuneCountInString(t.notice)+utf8.RuneCountInString(help) > t.cols {
+		return style + fit(t.notice, t.cols)
+	}
+	return style + t.notice + styleReset + styleDim + fit(help, t.cols-utf8.RuneCountInString(t.notice))
+}
+
+func (t *tui) inspectScreen() []string {
+	details := t.details(t.inspected)
+	height := t.rows - 2
+	t.scroll = max(0, min(t.scroll, len(details)-height))
+
+	lines := []string{styleInvert + fit(fmt.Sprintf(" Message #%v — esc back  ↑↓ scroll  c copy body", t.inspected.n), t.cols)}
+	for i := t.scroll; i < t.scroll+height; i++ {
+		if i < len(details) {
+			lines = append(lines, details[i])
+		} else {
+			lines = append(lines, "")
+		}
+	}
+
+	return append(lines, t.statusLine())
+}
+
+// details returns the lines describing `m`, wrapped to the width of the terminal
+func (t *tui) details(m *message) []string {
+	field := func(name string, value any) string {
+		return styleBold + fmt.Sprintf("%-12v", name) + styleReset + " " + fmt.Sprint(value)
+	}
+	from := fmt.Sprintf("#%v %v@%v from %v", m.Connection, m.User, m.VHost, m.RemoteAddr)
+	if m.Connection == 0 {
+		from = "published through the HTTP API to " + m.VHost
+	}
+	lines := []string{
+		field("Time", m.Time.Format(time.RFC3339Nano)),
+		field("Connection", from),
+		field("Channel", m.Channel),
+		field("Exchange", m.Exchange),
+		field("Routing key", m.RoutingKey),
+		field("Queues", strings.Join(m.Queues, ", ")),
+		field("Size", m.Size),
+	}
+	if m.DecodedSize != 0 {
+		lines = append(lines, field("Decoded", m.DecodedSize))
+	}
+
+	if m.Properties != nil {
+		properties, err := json.MarshalIndent(m.Properties, "", "  ")
+		if err != nil {
+			properties = []byte(err.Error())
+		}
+		lines = append(lines, "", styleBold+"Properties"+styleReset)
+		lines = append(lines, wrap(string(properties), t.cols)...)
+	}
+
+	lines = append(lines, "", styleBold+"Body"+styleReset)
+	switch {
+	case m.Protobuf != nil:
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, m.Protobuf, "", "  "); err != nil {
+			indented.Reset()
+			indented.Write(m.Protobuf)
+		}
+		lines = append(lines, wrap(indented.String(), t.cols)...)
+	case m.BodyBase64 != "":
+		data := m.Content
+		if m.Decoded != nil {
+			data = m.Decoded
+		}
+		lines = append(lines, wrap(strings.TrimSuffix(hex.Dump(data), "\n"), t.cols)...)
+	default:
+		lines = append(lines, wrap(m.Body, t.cols)...)
+	}
+
+	return lines
+}
+
+// body returns the body of a message as shown in the list
+func body(e *server.Event) string {
+	switch {
+	case e.Protobuf != nil:
+		return string(e.Protobuf)
+	case e.BodyBase64 != "":
+		return fmt.Sprintf("(%v bytes binary)", len(e.Content))
+	}
+
+	return e.Body
+}
+
+// fit makes `s` exactly `width` columns wide, replacing control characters and cutting it off with …
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+
+	runes := []rune(strings.Map(printable, s))
+	if len(runes) > width {
+		return string(runes[:width-1]) + "…"
+	}
+	return string(runes) + strings.Repeat(" ", width-len(runes))
+}
+
+// wrap splits `s` into lines of at most `width` columns
+func wrap(s string, width int) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		runes := []rune(strings.Map(printable, line))
+		for len(runes) > width && width > 0 {
+			lines = append(lines, string(runes[:width]))
+			runes = runes[width:]
+		}
+		lines = append(lines, string(runes))
+	}
+
+	return lines
+}
+
+// printable replaces characters that would move the cursor or change the terminal
+func printable(r rune) rune {
+	switch {
+	case r == '\t':
+		return ' '
+	case unicode.IsControl(r):
+		return '·'
+	}
+
+	return r
+}
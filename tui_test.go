@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/resamvi/amqparrot/server"
+)
+
+func TestFit(t *testing.T) {
+	for _, tc := range []struct {
+		s        string
+		width    int
+		expected string
+	}{
+		{"orders", 8, "orders  "},
+		{"orders", 6, "orders"},
+		{"order.created", 6, "order…"},
+		{"a\tb\nc", 5, "a b·c"},
+		{"ünïcode", 4, "ünï…"},
+		{"orders", 0, ""},
+		{"orders", -3, ""},
+	} {
+		if fitted := fit(tc.s, tc.width); fitted != tc.expected {
+			t.Errorf("fit(%q, %v): expected %q, got %q", tc.s, tc.width, tc.expected, fitted)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	for _, tc := range []struct {
+		s        string
+		width    int
+		expected []string
+	}{
+		{"short", 10, []string{"short"}},
+		{"abcdefgh", 3, []string{"abc", "def", "gh"}},
+		{"ab\n\ncd\tef", 4, []string{"ab", "", "cd e", "f"}},
+		{"no width", 0, []string{"no width"}},
+	} {
+		if wrapped := wrap(tc.s, tc.width); !reflect.DeepEqual(wrapped, tc.expected) {
+			t.Errorf("wrap(%q, %v): expected %q, got %q", tc.s, tc.width, tc.expected, wrapped)
+		}
+	}
+}
+
+// messages returns a tui holding `count` messages with the bodies 1 to count
+func messages(count int) *tui {
+	t := &tui{srv: &server.Server{}, rows: 24, cols: 100, follow: true}
+	for i := 1; i <= count; i++ {
+		t.add(server.Event{Type: server.EventMessage, Body: fmt.Sprint(i)})
+	}
+
+	return t
+}
+
+func TestKeep(t *testing.T) {
+	ui := messages(tuiMessages + 5)
+	if len(ui.messages) != tuiMessages || ui.received != tuiMessages+5 {
+		t.Fatalf("expected %v of %v messages, got %v of %v", tuiMessages, tuiMessages+5, len(ui.messages), ui.received)
+	}
+	if first, last := ui.messages[0], ui.messages[len(ui.messages)-1]; first.n != 6 || first.Body != "6" || last.n != tuiMessages+5 {
+		t.Errorf("expected the oldest messages to be dropped, got #%v to #%v", first.n, last.n)
+	}
+
+	// messages held while paused are capped as well
+	ui.press('p')
+	for i := 0; i < 2*tuiMessages; i++ {
+		ui.add(server.Event{Type: server.EventMessage, Body: "held"})
+	}
+	if len(ui.held) != tuiMessages || ui.received != tuiMessages+5 {
+		t.Errorf("expected %v held messages, got %v", tuiMessages, len(ui.held))
+	}
+	ui.press('p')
+	if len(ui.held) != 0 || len(ui.messages) != tuiMessages || ui.messages[0].Body != "held" {
+		t.Errorf("expected held messages to be kept after resuming, got %v held", len(ui.held))
+	}
+}
+
+func TestMove(t *testing.T) {
+	ui := messages(10)
+	selected := func() string {
+		list := ui.visible()
+		return list[ui.cursor(list)].Body
+	}
+
+	if selected() != "10" {
+		t.Errorf("expected the newest message to be selected, got %v", selected())
+	}
+	ui.move(-3)
+	if selected() != "7" || ui.follow {
+		t.Errorf("expected message 7 to be selected without following, got %v", selected())
+	}
+	ui.add(server.Event{Type: server.EventMessage, Body: "11"})
+	if selected() != "7" {
+		t.Errorf("expected the selection to stay on message 7, got %v", selected())
+	}
+	ui.move(-100)
+	if selected() != "1" {
+		t.Errorf("expected the oldest message to be selected, got %v", selected())
+	}
+	ui.move(100)
+	if selected() != "11" || !ui.follow {
+		t.Errorf("expected to follow the newest message, got %v", selected())
+	}
+
+	// the filter keeps the selection on the nearest matching message
+	ui.move(-5)
+	ui.filter = "1"
+	if selected() != "10" {
+		t.Errorf("expected message 10 to be selected after filtering, got %v", selected())
+	}
+	ui.filter = "nothing"
+	ui.move(1)
+	if len(ui.visible()) != 0 || ui.cursor(ui.visible()) != -1 {
+		t.Errorf("expected no selection without visible messages")
+	}
+}
+
+func TestMessageColumns(t *testing.T) {
+	ui := messages(3)
+	for cols := 40; cols <= 160; cols++ {
+		ui.cols = cols
+		columns, bodyWidth := messageColumns(cols)
+		if bodyWidth <= 0 || columns[3] <= 0 || columns[4] <= 0 {
+			t.Errorf("expected positive widths at %v columns, got %v and body %v", cols, columns, bodyWidth)
+		}
+		for _, line := range ui.mainScreen() {
+			plain := line
+			for _, style := range []string{styleInvert, styleBold, styleDim, styleReset} {
+				plain = strings.ReplaceAll(plain, style, "")
+			}
+			if width := utf8.RuneCountInString(plain); width > cols {
+				t.Fatalf("line is %v wide on a terminal of %v columns: %q", width, cols, plain)
+			}
+		}
+	}
+
+	if columns, bodyWidth := messageColumns(100); columns[3] != 18 || columns[4] != 22 || bodyWidth != 26 {
+		t.Errorf("expected full width columns at 100 columns, got %v and body %v", columns, bodyWidth)
+	}
+}